@@ -6,6 +6,7 @@ require (
 	github.com/cloudfoundry/go-cfclient/v3 v3.0.0-alpha.9
 	github.com/google/go-cmp v0.7.0
 	github.com/spf13/cobra v1.8.1
+	golang.org/x/crypto v0.39.0
 )
 
 require (
@@ -34,5 +35,5 @@ require (
 	github.com/spf13/pflag v1.0.5 // indirect
 	github.com/stretchr/testify v1.9.0 // indirect
 	golang.org/x/oauth2 v0.27.0 // indirect
-	gopkg.in/yaml.v3 v3.0.1 // indirect
+	gopkg.in/yaml.v3 v3.0.1
 )
@@ -0,0 +1,116 @@
+package cloudgov
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// LogLine is a line of an app's logs from CF's log cache.
+type LogLine struct {
+	Time time.Time
+	// Where the line came from, e.g., "STG" for staging, "APP/PROC/WEB"
+	// for the app itself, or "CELL" for Diego
+	Source   string
+	Instance string
+	Stream   string // "OUT" or "ERR"
+	Message  string
+}
+
+// String formats l like `cf logs` does.
+func (l *LogLine) String() string {
+	return fmt.Sprintf(
+		"%v [%v/%v] %v %v",
+		l.Time.Format("2006-01-02T15:04:05.00-0700"), l.Source, l.Instance, l.Stream, l.Message,
+	)
+}
+
+// logKey tells apart lines logged at the same time.
+type logKey struct {
+	nanos                             int64
+	source, instance, stream, message string
+}
+
+func (l *LogLine) key() logKey {
+	return logKey{l.Time.UnixNano(), l.Source, l.Instance, l.Stream, l.Message}
+}
+
+// logsQuery picks which of an app's logs to read from log cache.
+type logsQuery struct {
+	start      time.Time // inclusive, zero for the oldest log cache has
+	limit      int       // log cache returns at most logsLimitMax
+	descending bool      // newest first
+}
+
+const (
+	logsLimitMax           = 1000
+	recentLogsLimitDefault = 100
+)
+
+// How often StreamLogs checks for new lines
+var logsPollInterval = time.Second
+
+// RecentLogs gets the last limit lines (or a default if limit < 1) of
+// app's logs, oldest first, including staging.
+func (c *Client) RecentLogs(ctx context.Context, app *App, limit int) ([]*LogLine, error) {
+	if limit < 1 {
+		limit = recentLogsLimitDefault
+	}
+
+	lines, err := c.appLogs(ctx, app.GUID, logsQuery{limit: min(limit, logsLimitMax), descending: true})
+	if err != nil {
+		return nil, err
+	}
+	slices.Reverse(lines)
+	return lines, nil
+}
+
+// StreamLogs calls out with each line of app's logs from since on, in
+// order, as they come in. It returns nil once ctx is done.
+//
+// Several lines can share a timestamp, and more can arrive at one we've
+// read up to, so each read starts at the last line's time and skips
+// lines we've already seen there.
+func (c *Client) StreamLogs(ctx context.Context, app *App, since time.Time, out func(*LogLine)) error {
+	next := since
+	seen := map[logKey]bool{} // lines at next we've sent out
+	for {
+		start := next
+		lines, err := c.appLogs(ctx, app.GUID, logsQuery{start: start, limit: logsLimitMax})
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		for _, l := range lines {
+			if seen[l.key()] {
+				continue
+			}
+			if l.Time.After(next) {
+				next = l.Time
+				clear(seen)
+			}
+			seen[l.key()] = true
+			out(l)
+		}
+
+		// A full page means there's more waiting for us
+		if len(lines) == logsLimitMax {
+			// but we can't page past a full page of one time, so skip it
+			if lines[len(lines)-1].Time.Equal(start) {
+				next = start.Add(time.Nanosecond)
+				clear(seen)
+			}
+			continue
+		}
+
+		select {
+		case <-time.After(logsPollInterval):
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
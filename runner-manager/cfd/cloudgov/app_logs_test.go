@@ -0,0 +1,248 @@
+package cloudgov
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestCFClientAPI_appLogs(t *testing.T) {
+	payload := func(s string) string { return base64.StdEncoding.EncodeToString([]byte(s)) }
+
+	cf := newFakeCF(t)
+	cf.logs = fmt.Sprintf(`{"envelopes":{"batch":[
+		{"timestamp":"1700000000000000000","source_id":"app-guid","instance_id":"0",
+		 "tags":{"source_type":"STG"},"log":{"payload":%q}},
+		{"timestamp":"1700000001000000000","source_id":"app-guid","instance_id":"0",
+		 "tags":{"source_type":"APP/PROC/WEB"},"gauge":{"metrics":{}}},
+		{"timestamp":"1700000002000000000","source_id":"app-guid","instance_id":"1",
+		 "tags":{"source_type":"APP/PROC/WEB"},"log":{"payload":%q,"type":"ERR"}}
+	]}}`, payload("Staging app...\n"), payload("FATAL: out of memory"))
+
+	api := &CFClientAPI{}
+	if err := api.connect(context.Background(), cf.URL, &Creds{Username: "u", Password: "p"}); err != nil {
+		t.Fatal(err)
+	}
+	rootReads := cf.rootReads
+
+	start := time.Unix(0, 1700000000000000000)
+	got, err := api.appLogs(context.Background(), "app-guid", logsQuery{start: start, limit: 10, descending: true})
+	if err != nil {
+		t.Fatalf("appLogs() error = %v", err)
+	}
+	want := []*LogLine{
+		{Time: start, Source: "STG", Instance: "0", Stream: "OUT", Message: "Staging app..."},
+		{
+			Time:     time.Unix(0, 1700000002000000000),
+			Source:   "APP/PROC/WEB",
+			Instance: "1",
+			Stream:   "ERR",
+			Message:  "FATAL: out of memory",
+		},
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("mismatch (-got +want):\n%s", diff)
+	}
+
+	if _, err := api.appLogs(context.Background(), "app-guid", logsQuery{}); err != nil {
+		t.Fatalf("appLogs() error = %v", err)
+	}
+
+	wantReads := []url.Values{
+		{
+			"envelope_types": {"LOG"},
+			"start_time":     {"1700000000000000000"},
+			"limit":          {"10"},
+			"descending":     {"true"},
+		},
+		{"envelope_types": {"LOG"}},
+	}
+	if diff := cmp.Diff(cf.logReads, wantReads); diff != "" {
+		t.Errorf("log cache query mismatch (-got +want):\n%s", diff)
+	}
+	if n := cf.rootReads - rootReads; n != 1 {
+		t.Errorf("looked up log cache %v times, want once", n)
+	}
+}
+
+func TestLogLine_String(t *testing.T) {
+	l := &LogLine{
+		Time:     time.Date(2025, 1, 2, 3, 4, 5, 60_000_000, time.UTC),
+		Source:   "APP/PROC/WEB",
+		Instance: "0",
+		Stream:   "ERR",
+		Message:  "listening on 5432",
+	}
+	want := "2025-01-02T03:04:05.06+0000 [APP/PROC/WEB/0] ERR listening on 5432"
+	if got := l.String(); got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+}
+
+// logsStub serves lines from log cache, as if they'd all arrived.
+type logsStub struct {
+	ClientAPI
+
+	mu      sync.Mutex
+	lines   []*LogLine // oldest first
+	queries []logsQuery
+}
+
+func (a *logsStub) appLogs(ctx context.Context, id string, q logsQuery) ([]*LogLine, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.queries = append(a.queries, q)
+
+	var lines []*LogLine
+	for _, l := range a.lines {
+		if !l.Time.Before(q.start) {
+			lines = append(lines, l)
+		}
+	}
+	if q.descending {
+		slices.Reverse(lines)
+	}
+	if q.limit > 0 && len(lines) > q.limit {
+		lines = lines[:q.limit]
+	}
+	return lines, nil
+}
+
+func logLines(n int) []*LogLine {
+	lines := make([]*LogLine, n)
+	for i := range lines {
+		lines[i] = &LogLine{Time: time.Unix(100+int64(i), 0), Message: fmt.Sprint(i)}
+	}
+	return lines
+}
+
+func messages(lines []*LogLine) []string {
+	msgs := make([]string, len(lines))
+	for i, l := range lines {
+		msgs[i] = l.Message
+	}
+	return msgs
+}
+
+func TestClient_RecentLogs(t *testing.T) {
+	stub := &logsStub{lines: logLines(5)}
+	c := &Client{ClientAPI: stub}
+
+	got, err := c.RecentLogs(context.Background(), &App{GUID: "app-guid"}, 3)
+	if err != nil {
+		t.Fatalf("RecentLogs() error = %v", err)
+	}
+	if diff := cmp.Diff(messages(got), []string{"2", "3", "4"}); diff != "" {
+		t.Errorf("mismatch (-got +want):\n%s", diff)
+	}
+
+	if _, err := c.RecentLogs(context.Background(), &App{GUID: "app-guid"}, 0); err != nil {
+		t.Fatalf("RecentLogs() error = %v", err)
+	}
+	if got := stub.queries[1].limit; got != recentLogsLimitDefault {
+		t.Errorf("RecentLogs() asked for %v lines, want the default %v", got, recentLogsLimitDefault)
+	}
+}
+
+func TestClient_StreamLogs(t *testing.T) {
+	defer func(d time.Duration) { logsPollInterval = d }(logsPollInterval)
+	logsPollInterval = time.Millisecond
+
+	stub := &logsStub{lines: logLines(3)}
+	c := &Client{ClientAPI: stub}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var got []*LogLine
+	err := c.StreamLogs(ctx, &App{GUID: "app-guid"}, time.Unix(101, 0), func(l *LogLine) {
+		got = append(got, l)
+		if l.Message == "2" {
+			// more comes in after the first read
+			stub.mu.Lock()
+			stub.lines = append(stub.lines, &LogLine{Time: time.Unix(200, 0), Message: "late"})
+			stub.mu.Unlock()
+		}
+		if l.Message == "late" {
+			cancel()
+		}
+	})
+	if err != nil {
+		t.Fatalf("StreamLogs() error = %v", err)
+	}
+
+	// each line once, none from before since
+	if diff := cmp.Diff(messages(got), []string{"1", "2", "late"}); diff != "" {
+		t.Errorf("mismatch (-got +want):\n%s", diff)
+	}
+}
+
+func TestClient_StreamLogs_sameTime(t *testing.T) {
+	defer func(d time.Duration) { logsPollInterval = d }(logsPollInterval)
+	logsPollInterval = time.Millisecond
+
+	at := func(secs int64, msg string) *LogLine {
+		return &LogLine{Time: time.Unix(secs, 0), Instance: "0", Message: msg}
+	}
+
+	t.Run("keeps lines that come in at a time already read", func(t *testing.T) {
+		stub := &logsStub{lines: []*LogLine{at(100, "a"), at(100, "b")}}
+		c := &Client{ClientAPI: stub}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		var got []*LogLine
+		err := c.StreamLogs(ctx, &App{GUID: "app-guid"}, time.Unix(100, 0), func(l *LogLine) {
+			got = append(got, l)
+			switch l.Message {
+			case "b":
+				stub.mu.Lock()
+				stub.lines = append(stub.lines, at(100, "c"), at(101, "d"))
+				stub.mu.Unlock()
+			case "d":
+				cancel()
+			}
+		})
+		if err != nil {
+			t.Fatalf("StreamLogs() error = %v", err)
+		}
+
+		if diff := cmp.Diff(messages(got), []string{"a", "b", "c", "d"}); diff != "" {
+			t.Errorf("mismatch (-got +want):\n%s", diff)
+		}
+	})
+
+	t.Run("moves past a full page of one time", func(t *testing.T) {
+		stub := &logsStub{}
+		for i := range logsLimitMax {
+			stub.lines = append(stub.lines, at(100, fmt.Sprint(i)))
+		}
+		stub.lines = append(stub.lines, at(101, "late"))
+		c := &Client{ClientAPI: stub}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		n := 0
+		err := c.StreamLogs(ctx, &App{GUID: "app-guid"}, time.Unix(100, 0), func(l *LogLine) {
+			n++
+			if l.Message == "late" {
+				cancel()
+			}
+		})
+		if err != nil {
+			t.Fatalf("StreamLogs() error = %v", err)
+		}
+		if n != logsLimitMax+1 {
+			t.Errorf("StreamLogs() sent out %v lines, want %v", n, logsLimitMax+1)
+		}
+	})
+}
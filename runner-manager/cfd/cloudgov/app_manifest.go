@@ -17,8 +17,15 @@ type AppManifestDocker struct {
 }
 
 type AppManifestProcess struct {
-	Command         string // Entrypoint + Cmd
+	Command         string   // Entrypoint + Cmd
+	Args            []string // for the image's own ENTRYPOINT, instead of Command
 	DiskQuota       string
 	Memory          string
-	HealthCheckType string
+	HealthCheckType string // "port", "process", or "http"
+
+	// Zero values leave these to CF's defaults
+	HealthCheckHTTPEndpoint      string // for "http" checks, e.g., "/healthz"
+	HealthCheckTimeout           uint   // seconds to first pass, CF's "timeout"
+	HealthCheckInvocationTimeout uint   // seconds each check gets
+	Instances                    uint
 }
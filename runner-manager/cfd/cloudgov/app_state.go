@@ -0,0 +1,202 @@
+package cloudgov
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// AppInstance is one of an app's web process instances.
+type AppInstance struct {
+	Index int
+	// "STARTING", "RUNNING", "CRASHED", or "DOWN"; instances are only
+	// RUNNING once their health check passes
+	State string
+	// Why CF couldn't place the instance, if it couldn't
+	Details string
+}
+
+// AppCrash is CF's record of an instance exiting when it shouldn't have,
+// from an "audit.app.process.crash" event.
+type AppCrash struct {
+	Index      int
+	ExitStatus int
+	// e.g., "APP/PROC/WEB: Exited with status 137 (out of memory)" or
+	// "Instance never healthy after 1m0s: ..."
+	ExitDescription string
+	Reason          string // e.g., "CRASHED"
+	At              time.Time
+}
+
+// parseCrashData reads the fields we use from a crash event's data.
+func parseCrashData(data []byte, at time.Time) (*AppCrash, error) {
+	var d struct {
+		Index           int    `json:"index"`
+		ExitStatus      int    `json:"exit_status"`
+		ExitDescription string `json:"exit_description"`
+		Reason          string `json:"reason"`
+	}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &d); err != nil {
+			return nil, fmt.Errorf("error parsing crash event: %w", err)
+		}
+	}
+	return &AppCrash{
+		Index:           d.Index,
+		ExitStatus:      d.ExitStatus,
+		ExitDescription: d.ExitDescription,
+		Reason:          d.Reason,
+		At:              at,
+	}, nil
+}
+
+// Why instances didn't reach a state, to check for with errors.Is on an
+// InstanceStateError.
+var (
+	ErrImagePull   = errors.New("image pull failed")
+	ErrOutOfMemory = errors.New("out of memory")
+	ErrHealthCheck = errors.New("health check never passed")
+	ErrCrashed     = errors.New("crashed")
+)
+
+// InstanceStateError is an app whose instances didn't reach a state.
+type InstanceStateError struct {
+	App  string
+	Want string
+	// One of the kinds above, or nil if the instances just took too long
+	Kind      error
+	TimedOut  bool
+	Instances []*AppInstance // as we last saw them
+	Crashes   []*AppCrash    // newest first
+}
+
+func (e *InstanceStateError) Error() string {
+	var b strings.Builder
+
+	var why []string
+	if e.TimedOut {
+		why = append(why, "timed out")
+	}
+	if e.Kind != nil {
+		why = append(why, e.Kind.Error())
+	}
+	fmt.Fprintf(&b, "app %v didn't reach %v: %v", e.App, e.Want, strings.Join(why, ", "))
+
+	states := make([]string, len(e.Instances))
+	for i, inst := range e.Instances {
+		states[i] = fmt.Sprintf("%d %v", inst.Index, inst.State)
+		if inst.Details != "" {
+			states[i] += fmt.Sprintf(" (%v)", inst.Details)
+		}
+	}
+	fmt.Fprintf(&b, ", instances: [%v]", strings.Join(states, ", "))
+
+	if len(e.Crashes) > 0 {
+		c := e.Crashes[0]
+		fmt.Fprintf(&b, ", last crash: instance %d exited %d: %v", c.Index, c.ExitStatus, c.ExitDescription)
+	}
+	return b.String()
+}
+
+func (e *InstanceStateError) Is(target error) bool {
+	return e.Kind != nil && target == e.Kind
+}
+
+// crashKind works out why instances failed from what CF tells us about
+// them, newest crash first, or nil if nothing failed.
+func crashKind(instances []*AppInstance, crashes []*AppCrash) error {
+	var reasons []string
+	for _, inst := range instances {
+		reasons = append(reasons, inst.Details)
+	}
+	for _, c := range crashes {
+		reasons = append(reasons, c.ExitDescription)
+	}
+
+	for _, r := range reasons {
+		r = strings.ToLower(r)
+		switch {
+		case strings.Contains(r, "image") &&
+			(strings.Contains(r, "pull") || strings.Contains(r, "fetch") || strings.Contains(r, "download")):
+			return ErrImagePull
+		case strings.Contains(r, "out of memory"):
+			return ErrOutOfMemory
+		case strings.Contains(r, "never healthy") || strings.Contains(r, "health check"):
+			return ErrHealthCheck
+		}
+	}
+
+	if len(crashes) > 0 || instancesIn(instances, "CRASHED", false) {
+		return ErrCrashed
+	}
+	return nil
+}
+
+// instancesIn is true if all instances are in state, or if any are when
+// all is false. It's false without instances.
+func instancesIn(instances []*AppInstance, state string, all bool) bool {
+	if len(instances) < 1 {
+		return false
+	}
+	for _, inst := range instances {
+		in := inst.State == state
+		if all && !in {
+			return false
+		}
+		if !all && in {
+			return true
+		}
+	}
+	return all
+}
+
+// How often WaitForState checks on instances
+var instanceStatePollInterval = 5 * time.Second
+
+// WaitForState polls app's web instances until they're all in state,
+// e.g., "RUNNING", or until deadline. If they crash on the way or time
+// out, it returns an *InstanceStateError saying why, as best CF can tell.
+func (c *Client) WaitForState(ctx context.Context, app *App, state string, deadline time.Time) error {
+	for {
+		instances, err := c.appInstances(ctx, app.GUID)
+		if err != nil {
+			return err
+		}
+		if instancesIn(instances, state, true) {
+			return nil
+		}
+
+		// CF restarts crashed instances, but for us it's already failed
+		crashed := state != "CRASHED" && instancesIn(instances, "CRASHED", false)
+		wait := time.Until(deadline)
+		if crashed || wait <= 0 {
+			return c.instanceStateError(ctx, app, state, instances, !crashed)
+		}
+
+		select {
+		case <-time.After(min(wait, instanceStatePollInterval)):
+		case <-ctx.Done():
+			return fmt.Errorf("stopped waiting for app %v: %w", app.Name, ctx.Err())
+		}
+	}
+}
+
+func (c *Client) instanceStateError(
+	ctx context.Context, app *App, state string, instances []*AppInstance, timedOut bool,
+) error {
+	// We'd rather report what we saw than fail on the way out, so
+	// a failed lookup just means no crashes to go on
+	crashes, _ := c.appCrashes(ctx, app.GUID)
+
+	return &InstanceStateError{
+		App:       app.Name,
+		Want:      state,
+		Kind:      crashKind(instances, crashes),
+		TimedOut:  timedOut,
+		Instances: instances,
+		Crashes:   crashes,
+	}
+}
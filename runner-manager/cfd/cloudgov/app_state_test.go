@@ -0,0 +1,231 @@
+package cloudgov
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// instancesStub returns each of polls in turn, then the last one forever.
+type instancesStub struct {
+	ClientAPI
+
+	polls     [][]*AppInstance
+	crashes   []*AppCrash
+	failPoll  bool
+	pollCount int
+}
+
+func (a *instancesStub) appInstances(ctx context.Context, id string) ([]*AppInstance, error) {
+	if a.failPoll {
+		return nil, &testErr{"failPoll"}
+	}
+	i := min(a.pollCount, len(a.polls)-1)
+	a.pollCount++
+	return a.polls[i], nil
+}
+
+func (a *instancesStub) appCrashes(ctx context.Context, id string) ([]*AppCrash, error) {
+	return a.crashes, nil
+}
+
+func instances(states ...string) []*AppInstance {
+	insts := make([]*AppInstance, len(states))
+	for i, s := range states {
+		insts[i] = &AppInstance{Index: i, State: s}
+	}
+	return insts
+}
+
+func TestClient_WaitForState(t *testing.T) {
+	instanceStatePollInterval = time.Millisecond
+	defer func() { instanceStatePollInterval = 5 * time.Second }()
+
+	tests := map[string]struct {
+		stub         *instancesStub
+		timeout      time.Duration
+		wantKind     error
+		wantTimedOut bool
+		wantPolls    int
+		wantErr      string
+	}{
+		"returns once all instances are running": {
+			stub: &instancesStub{polls: [][]*AppInstance{
+				instances(),
+				instances("STARTING", "STARTING"),
+				instances("RUNNING", "STARTING"),
+				instances("RUNNING", "RUNNING"),
+			}},
+			wantPolls: 4,
+		},
+		"fails as soon as an instance crashes": {
+			stub: &instancesStub{
+				polls: [][]*AppInstance{instances("STARTING"), instances("CRASHED")},
+				crashes: []*AppCrash{{
+					ExitStatus:      137,
+					ExitDescription: "APP/PROC/WEB: Exited with status 137 (out of memory)",
+				}},
+			},
+			wantKind:  ErrOutOfMemory,
+			wantPolls: 2,
+			wantErr:   "app test didn't reach RUNNING: out of memory, instances: [0 CRASHED], last crash: instance 0 exited 137",
+		},
+		"times out with the reason instances keep restarting": {
+			stub: &instancesStub{
+				polls: [][]*AppInstance{instances("STARTING")},
+				crashes: []*AppCrash{{
+					ExitDescription: "Instance never healthy after 1m0s: Failed to make TCP connection to port 8080",
+				}},
+			},
+			timeout:      10 * time.Millisecond,
+			wantKind:     ErrHealthCheck,
+			wantTimedOut: true,
+			wantErr:      "timed out, health check never passed",
+		},
+		"times out without a reason": {
+			stub:         &instancesStub{polls: [][]*AppInstance{instances("STARTING")}},
+			wantTimedOut: true,
+			wantErr:      "app test didn't reach RUNNING: timed out, instances: [0 STARTING]",
+		},
+		"fails if it can't check on instances": {
+			stub:    &instancesStub{failPoll: true},
+			wantErr: "failPoll",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			c := &Client{ClientAPI: tt.stub}
+			timeout := tt.timeout
+			if timeout == 0 {
+				timeout = time.Second
+				if tt.wantTimedOut {
+					timeout = 0
+				}
+			}
+
+			err := c.WaitForState(context.Background(), &App{Name: "test"}, "RUNNING", time.Now().Add(timeout))
+			if (err != nil) != (tt.wantErr != "") {
+				t.Fatalf("WaitForState() error = %v, wantErr %q", err, tt.wantErr)
+			}
+			if err != nil && !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("WaitForState() error = %v, want it to contain %q", err, tt.wantErr)
+			}
+			if tt.wantPolls > 0 && tt.stub.pollCount != tt.wantPolls {
+				t.Errorf("WaitForState() polled %v times, want %v", tt.stub.pollCount, tt.wantPolls)
+			}
+
+			var stateErr *InstanceStateError
+			if !errors.As(err, &stateErr) {
+				return
+			}
+			if stateErr.Kind != tt.wantKind || stateErr.TimedOut != tt.wantTimedOut {
+				t.Errorf(
+					"WaitForState() error kind = %v, timed out = %v, want %v, %v",
+					stateErr.Kind, stateErr.TimedOut, tt.wantKind, tt.wantTimedOut,
+				)
+			}
+			if tt.wantKind != nil && !errors.Is(err, tt.wantKind) {
+				t.Errorf("WaitForState() error = %v, want it to be %v", err, tt.wantKind)
+			}
+		})
+	}
+}
+
+func TestClient_WaitForState_stopsWhenCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	c := &Client{ClientAPI: &instancesStub{polls: [][]*AppInstance{instances("STARTING")}}}
+	err := c.WaitForState(ctx, &App{Name: "test"}, "RUNNING", time.Now().Add(time.Hour))
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("WaitForState() error = %v, want context.Canceled", err)
+	}
+}
+
+func Test_crashKind(t *testing.T) {
+	tests := map[string]struct {
+		instances []*AppInstance
+		crashes   []string
+		want      error
+	}{
+		"is nil without failures": {
+			instances: instances("STARTING"),
+		},
+		"spots image pulls": {
+			instances: []*AppInstance{{State: "DOWN", Details: "failed to pull image docker.io/library/nope"}},
+			want:      ErrImagePull,
+		},
+		"spots image downloads in crashes": {
+			crashes: []string{"Failed to create container: downloading image layer: unauthorized"},
+			want:    ErrImagePull,
+		},
+		"spots OOMs": {
+			crashes: []string{"APP/PROC/WEB: Exited with status 137 (out of memory)"},
+			want:    ErrOutOfMemory,
+		},
+		"spots health checks": {
+			crashes: []string{"Instance never healthy after 1m0s: Failed to make TCP connection to port 5432"},
+			want:    ErrHealthCheck,
+		},
+		"goes by the newest crash": {
+			crashes: []string{
+				"APP/PROC/WEB: Exited with status 137 (out of memory)",
+				"Instance never healthy after 1m0s",
+			},
+			want: ErrOutOfMemory,
+		},
+		"falls back to crashed for other crashes": {
+			crashes: []string{"APP/PROC/WEB: Exited with status 1"},
+			want:    ErrCrashed,
+		},
+		"falls back to crashed for crashed instances": {
+			instances: instances("RUNNING", "CRASHED"),
+			want:      ErrCrashed,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			var crashes []*AppCrash
+			for _, d := range tt.crashes {
+				crashes = append(crashes, &AppCrash{ExitDescription: d})
+			}
+			if got := crashKind(tt.instances, crashes); got != tt.want {
+				t.Errorf("crashKind() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_parseCrashData(t *testing.T) {
+	at := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	data := `{
+		"instance": "abc", "index": 1, "cell_id": "cell",
+		"exit_status": 137, "exit_description": "APP/PROC/WEB: Exited with status 137 (out of memory)",
+		"reason": "CRASHED", "crash_count": 2
+	}`
+
+	got, err := parseCrashData([]byte(data), at)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &AppCrash{
+		Index:           1,
+		ExitStatus:      137,
+		ExitDescription: "APP/PROC/WEB: Exited with status 137 (out of memory)",
+		Reason:          "CRASHED",
+		At:              at,
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("mismatch (-got +want):\n%s", diff)
+	}
+
+	if _, err := parseCrashData([]byte("{"), at); err == nil {
+		t.Error("parseCrashData() succeeded with malformed data")
+	}
+}
@@ -2,9 +2,13 @@ package cloudgov
 
 import (
 	"context"
-	"os"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
 	"strconv"
 	"strings"
+	"sync"
 
 	"code.cloudfoundry.org/lager/v3"
 	"code.cloudfoundry.org/policy_client"
@@ -17,10 +21,22 @@ import (
 
 type CFClientAPI struct {
 	_con *client.Client
+
+	mu       sync.Mutex
+	logCache string // log cache's URL, once we've looked it up
 }
 
-func (cf *CFClientAPI) connect(url string, creds *Creds) error {
-	cfg, err := config.New(url, config.UserPassword(creds.Username, creds.Password))
+func (cf *CFClientAPI) connect(ctx context.Context, url string, creds *Creds) error {
+	// go-cfclient doesn't take a context when connecting
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	cfg, err := config.New(
+		url,
+		config.UserPassword(creds.Username, creds.Password),
+		config.HttpClient(&http.Client{Transport: newResponseInfoTransport()}),
+	)
 	if err != nil {
 		return err
 	}
@@ -42,38 +58,32 @@ func (cf *CFClientAPI) conn() *client.Client {
 }
 
 func toCFManifest(am *AppManifest) *operation.AppManifest {
+	var instances *uint
+	if am.Process.Instances > 0 {
+		instances = &am.Process.Instances
+	}
+
 	return &operation.AppManifest{
 		Name:    am.Name,
 		Env:     am.Env,
-		NoRoute: true,
+		NoRoute: am.NoRoute,
 		Docker: &operation.AppManifestDocker{
 			Image:    am.Docker.Image,
 			Username: am.Docker.Username,
 		},
 		AppManifestProcess: operation.AppManifestProcess{
-			Command:         am.Process.Command,
-			Memory:          am.Process.Memory,
-			DiskQuota:       am.Process.DiskQuota,
-			HealthCheckType: operation.AppHealthCheckType(am.Process.HealthCheckType),
+			Command:                      am.Process.Command,
+			Memory:                       am.Process.Memory,
+			DiskQuota:                    am.Process.DiskQuota,
+			HealthCheckType:              operation.AppHealthCheckType(am.Process.HealthCheckType),
+			HealthCheckHTTPEndpoint:      am.Process.HealthCheckHTTPEndpoint,
+			Timeout:                      am.Process.HealthCheckTimeout,
+			HealthCheckInvocationTimeout: am.Process.HealthCheckInvocationTimeout,
+			Instances:                    instances,
 		},
 	}
 }
 
-// TODO: #95 - we'll want to change how docker creds get passed
-func (cf *CFClientAPI) appPush(m *AppManifest) (*App, error) {
-	// Initializes some state for the CF lib w/ connected client and org/space
-	op := operation.NewAppPushOperation(cf._con, m.OrgName, m.SpaceName)
-
-	// Translate manifest
-	cfManifest := toCFManifest(m)
-
-	// op.Push is a go-ified cli cmd, currently only takes env pass, see #95
-	os.Setenv("CF_DOCKER_PASSWORD", m.Docker.Password)
-
-	app, err := op.Push(context.Background(), cfManifest, nil)
-	return castApp(app), err
-}
-
 func castApp(app *resource.App) *App {
 	if app == nil || app.GUID == "" {
 		return nil
@@ -89,29 +99,251 @@ func castApps(apps []*resource.App) []*App {
 	return Apps
 }
 
-func (cf *CFClientAPI) appGet(id string) (*App, error) {
-	app, err := cf.conn().Applications.Get(context.Background(), id)
+func (cf *CFClientAPI) appGet(ctx context.Context, id string) (_ *App, err error) {
+	ctx, info := withResponseInfo(ctx)
+	defer func() { err = toAPIError(err, info) }()
+
+	app, err := cf.conn().Applications.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return castApp(app), nil
+}
+
+func (cf *CFClientAPI) appFind(ctx context.Context, orgName string, spaceName string, name string) (_ *App, err error) {
+	ctx, info := withResponseInfo(ctx)
+	defer func() { err = toAPIError(err, info) }()
+
+	space, err := cf.findSpace(ctx, orgName, spaceName)
+	if err != nil {
+		return nil, err
+	}
+
+	app, err := cf.findApp(ctx, space.GUID, name)
+	if err != nil {
+		return nil, err
+	}
+	return castApp(app), nil
+}
+
+func (cf *CFClientAPI) appFindInSpace(ctx context.Context, spaceGUID string, name string) (_ *App, err error) {
+	ctx, info := withResponseInfo(ctx)
+	defer func() { err = toAPIError(err, info) }()
+
+	app, err := cf.findApp(ctx, spaceGUID, name)
 	if err != nil {
 		return nil, err
 	}
 	return castApp(app), nil
 }
 
-func (cf *CFClientAPI) appDelete(id string) error {
-	_, err := cf.conn().Applications.Delete(context.Background(), id)
+func (cf *CFClientAPI) spaceFind(ctx context.Context, orgName string, spaceName string) (_ *Space, err error) {
+	ctx, info := withResponseInfo(ctx)
+	defer func() { err = toAPIError(err, info) }()
+
+	return cf.findSpace(ctx, orgName, spaceName)
+}
+
+func (cf *CFClientAPI) spaceGet(ctx context.Context, guid string) (_ *Space, err error) {
+	ctx, info := withResponseInfo(ctx)
+	defer func() { err = toAPIError(err, info) }()
+
+	s, org, err := cf.conn().Spaces.GetIncludeOrganization(ctx, guid)
+	if kindOf(err, 0) == ErrNotFound {
+		return nil, &SpaceAccessError{Space: guid, Err: err}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &Space{GUID: s.GUID, Name: s.Name, OrgGUID: org.GUID, OrgName: org.Name}, nil
+}
+
+// findSpace resolves org and space names. CF hides what the service
+// account has no role in, so not finding them is a SpaceAccessError.
+func (cf *CFClientAPI) findSpace(ctx context.Context, orgName string, spaceName string) (*Space, error) {
+	orgOpts := client.NewOrganizationListOptions()
+	orgOpts.Names.EqualTo(orgName)
+	org, err := cf.conn().Organizations.Single(ctx, orgOpts)
+	if kindOf(err, 0) == ErrNotFound {
+		return nil, &SpaceAccessError{Org: orgName, Space: spaceName, Err: fmt.Errorf("org %s: %w", orgName, err)}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not find org %s: %w", orgName, err)
+	}
+
+	spaceOpts := client.NewSpaceListOptions()
+	spaceOpts.Names.EqualTo(spaceName)
+	spaceOpts.OrganizationGUIDs.EqualTo(org.GUID)
+	s, err := cf.conn().Spaces.Single(ctx, spaceOpts)
+	if kindOf(err, 0) == ErrNotFound {
+		return nil, &SpaceAccessError{Org: orgName, Space: spaceName, Err: err}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not find space %s: %w", spaceName, err)
+	}
+
+	return &Space{GUID: s.GUID, Name: s.Name, OrgGUID: org.GUID, OrgName: org.Name}, nil
+}
+
+func (cf *CFClientAPI) findApp(ctx context.Context, spaceGUID string, name string) (*resource.App, error) {
+	appOpts := client.NewAppListOptions()
+	appOpts.Names.EqualTo(name)
+	appOpts.SpaceGUIDs.EqualTo(spaceGUID)
+	app, err := cf.conn().Applications.Single(ctx, appOpts)
+	if err != nil {
+		return nil, fmt.Errorf("could not find app %s: %w", name, err)
+	}
+	return app, nil
+}
+
+func (cf *CFClientAPI) appDelete(ctx context.Context, id string) (err error) {
+	ctx, info := withResponseInfo(ctx)
+	defer func() { err = toAPIError(err, info) }()
+
+	_, err = cf.conn().Applications.Delete(ctx, id)
 	return err
 }
 
-func (cf *CFClientAPI) appsList() ([]*App, error) {
-	apps, err := cf.conn().Applications.ListAll(context.Background(), nil)
+func (cf *CFClientAPI) appsList(ctx context.Context) (_ []*App, err error) {
+	ctx, info := withResponseInfo(ctx)
+	defer func() { err = toAPIError(err, info) }()
+
+	apps, err := cf.conn().Applications.ListAll(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	return castApps(apps), nil
+}
+
+func (cf *CFClientAPI) appsListFiltered(ctx context.Context, f *AppsFilter) (_ []*App, err error) {
+	ctx, info := withResponseInfo(ctx)
+	defer func() { err = toAPIError(err, info) }()
+
+	opts := client.NewAppListOptions()
+	opts.SpaceGUIDs.EqualTo(f.SpaceGUIDs...)
+	opts.Names.EqualTo(f.Names...)
+	if len(f.Labels) > 0 {
+		opts.LabelSel = client.LabelSelector{}
+		for k, v := range f.Labels {
+			if v == "" {
+				opts.LabelSel.Existence(k)
+			} else {
+				opts.LabelSel.EqualTo(k, v)
+			}
+		}
+	}
+
+	apps, err := cf.conn().Applications.ListAll(ctx, opts)
 	if err != nil {
 		return nil, err
 	}
 	return castApps(apps), nil
 }
 
-func (cf *CFClientAPI) sshCode() (string, error) {
-	ctx := context.Background()
+func (cf *CFClientAPI) appExposedPorts(ctx context.Context, id string) (_ []int, err error) {
+	ctx, info := withResponseInfo(ctx)
+	defer func() { err = toAPIError(err, info) }()
+
+	droplet, err := cf.conn().Droplets.GetCurrentForApp(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return parseExposedPorts(droplet.ExecutionMetadata)
+}
+
+func (cf *CFClientAPI) appInstances(ctx context.Context, id string) (_ []*AppInstance, err error) {
+	ctx, info := withResponseInfo(ctx)
+	defer func() { err = toAPIError(err, info) }()
+
+	stats, err := cf.conn().Processes.GetStatsForApp(ctx, id, "web")
+	if err != nil {
+		return nil, err
+	}
+
+	instances := make([]*AppInstance, len(stats.Stats))
+	for i, stat := range stats.Stats {
+		instances[i] = &AppInstance{Index: stat.Index, State: stat.State}
+		if stat.Details != nil {
+			instances[i].Details = *stat.Details
+		}
+	}
+	return instances, nil
+}
+
+// appCrashesLimit is how many of an app's crashes we look at, newest first
+const appCrashesLimit = 10
+
+func (cf *CFClientAPI) appCrashes(ctx context.Context, id string) (_ []*AppCrash, err error) {
+	ctx, info := withResponseInfo(ctx)
+	defer func() { err = toAPIError(err, info) }()
+
+	opts := client.NewAuditEventListOptions()
+	opts.Types.EqualTo("audit.app.process.crash")
+	opts.TargetGUIDs.EqualTo(id)
+	opts.OrderBy = "-created_at"
+	opts.PerPage = appCrashesLimit
+
+	events, _, err := cf.conn().AuditEvents.List(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	crashes := make([]*AppCrash, len(events))
+	for i, e := range events {
+		var data []byte
+		if e.Data != nil {
+			data = *e.Data
+		}
+		if crashes[i], err = parseCrashData(data, e.CreatedAt); err != nil {
+			return nil, err
+		}
+	}
+	return crashes, nil
+}
+
+// parseExposedPorts reads the ports Diego found in a docker image's
+// config during staging from a droplet's execution metadata.
+func parseExposedPorts(meta string) ([]int, error) {
+	if meta == "" {
+		return nil, nil
+	}
+
+	var m struct {
+		Ports []struct {
+			Port     int
+			Protocol string
+		}
+	}
+	if err := json.Unmarshal([]byte(meta), &m); err != nil {
+		return nil, fmt.Errorf("error parsing droplet execution metadata: %w", err)
+	}
+
+	var ports []int
+	for _, p := range m.Ports {
+		if p.Protocol == "" || strings.EqualFold(p.Protocol, "tcp") {
+			ports = append(ports, p.Port)
+		}
+	}
+	return ports, nil
+}
+
+// parseEntrypoint reads a docker image's ENTRYPOINT, which Diego finds
+// during staging, from a droplet's execution metadata.
+func parseEntrypoint(meta string) ([]string, error) {
+	var m struct {
+		Entrypoint []string
+	}
+	if err := json.Unmarshal([]byte(meta), &m); err != nil {
+		return nil, fmt.Errorf("error parsing droplet execution metadata: %w", err)
+	}
+	return m.Entrypoint, nil
+}
+
+func (cf *CFClientAPI) sshCode(ctx context.Context) (_ string, err error) {
+	ctx, info := withResponseInfo(ctx)
+	defer func() { err = toAPIError(err, info) }()
+
 	return cf.conn().SSHCode(ctx)
 }
 
@@ -119,7 +351,10 @@ func (cf *CFClientAPI) mapRoute(
 	ctx context.Context,
 	app *App,
 	domain string, space string, host string, path string, port int,
-) error {
+) (err error) {
+	ctx, info := withResponseInfo(ctx)
+	defer func() { err = toAPIError(err, info) }()
+
 	opts := resource.NewRouteCreateWithHost(domain, space, host, path, port)
 
 	route, err := cf.conn().Routes.Create(ctx, opts)
@@ -137,6 +372,24 @@ func (cf *CFClientAPI) mapRoute(
 	return err
 }
 
+func (cf *CFClientAPI) deleteAppRoutes(ctx context.Context, appGUID string) (err error) {
+	ctx, info := withResponseInfo(ctx)
+	defer func() { err = toAPIError(err, info) }()
+
+	routes, err := cf.conn().Routes.ListForAppAll(ctx, appGUID, nil)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, route := range routes {
+		if _, err := cf.conn().Routes.Delete(ctx, route.GUID); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
 func parsePortRange(prange string) (start int, end int, err error) {
 	ports := strings.Split(prange, "-")
 
@@ -153,12 +406,37 @@ func parsePortRange(prange string) (start int, end int, err error) {
 	return
 }
 
-func (cf *CFClientAPI) addNetworkPolicy(fromGUID string, toGUID string, portRanges []string) error {
-	pclient := policy_client.NewExternal(
+// policyClient talks to CF's network policy API. policy_client doesn't
+// take a context, so we add ctx to its requests ourselves.
+func (cf *CFClientAPI) policyClient(ctx context.Context) *policy_client.ExternalClient {
+	return policy_client.NewExternal(
 		lager.NewLogger("ExternalPolicyClient"),
-		cf.conn().HTTPAuthClient(),
+		ctxHTTPClient{ctx: ctx, client: cf.conn().HTTPAuthClient()},
 		cf.conn().ApiURL(""),
 	)
+}
+
+// ctxHTTPClient sends requests with ctx, so they're cancelled with it and
+// fill in its responseInfo.
+type ctxHTTPClient struct {
+	ctx    context.Context
+	client *http.Client
+}
+
+func (c ctxHTTPClient) Do(req *http.Request) (*http.Response, error) {
+	return c.client.Do(req.WithContext(c.ctx))
+}
+
+func (cf *CFClientAPI) addNetworkPolicy(ctx context.Context, fromGUID string, toGUID string, portRanges []string) (err error) {
+	ctx, info := withResponseInfo(ctx)
+	defer func() { err = toAPIError(err, info) }()
+
+	// policy_client's errors don't wrap ours, so check before we call it
+	if err = ctx.Err(); err != nil {
+		return err
+	}
+
+	pclient := cf.policyClient(ctx)
 
 	policies := make([]policy_client.Policy, len(portRanges))
 
@@ -180,3 +458,24 @@ func (cf *CFClientAPI) addNetworkPolicy(fromGUID string, toGUID string, portRang
 
 	return pclient.AddPolicies("", policies)
 }
+
+func (cf *CFClientAPI) removeNetworkPolicies(ctx context.Context, guid string) (err error) {
+	ctx, info := withResponseInfo(ctx)
+	defer func() { err = toAPIError(err, info) }()
+
+	if err = ctx.Err(); err != nil {
+		return err
+	}
+
+	pclient := cf.policyClient(ctx)
+
+	policies, err := pclient.GetPoliciesByID("", guid)
+	if err != nil {
+		return err
+	}
+	if len(policies) < 1 {
+		return nil
+	}
+
+	return pclient.DeletePolicies("", policies)
+}
@@ -1,6 +1,16 @@
 package cloudgov
 
-import "testing"
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/cloudfoundry/go-cfclient/v3/operation"
+	"github.com/google/go-cmp/cmp"
+)
 
 func Test_parsePortRange(t *testing.T) {
 	tests := []struct {
@@ -42,3 +52,165 @@ func Test_parsePortRange(t *testing.T) {
 		})
 	}
 }
+
+func Test_parseExposedPorts(t *testing.T) {
+	tests := map[string]struct {
+		meta    string
+		want    []int
+		wantErr bool
+	}{
+		"parses tcp ports": {
+			meta: `{"cmd":["postgres"],"ports":[{"Port":5432,"Protocol":"tcp"},{"Port":8125,"Protocol":"udp"}]}`,
+			want: []int{5432},
+		},
+		"parses no ports":               {meta: `{"cmd":["sh"]}`},
+		"parses empty metadata":         {},
+		"fails with malformed metadata": {meta: `{"ports":`, wantErr: true},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := parseExposedPorts(tt.meta)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseExposedPorts() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if diff := cmp.Diff(got, tt.want); diff != "" {
+				t.Errorf("mismatch (-got +want):\n%s", diff)
+			}
+		})
+	}
+}
+
+func Test_toCFManifest(t *testing.T) {
+	two := uint(2)
+
+	tests := map[string]struct {
+		manifest *AppManifest
+		want     *operation.AppManifest
+	}{
+		"carries everything through": {
+			manifest: &AppManifest{
+				Name:    "svc",
+				Env:     map[string]string{"FOO": "bar"},
+				NoRoute: true,
+				Docker:  AppManifestDocker{Image: "postgres:16", Username: "u", Password: "p"},
+				Process: AppManifestProcess{
+					Command:                      "postgres",
+					Memory:                       "512M",
+					DiskQuota:                    "1024M",
+					HealthCheckType:              "http",
+					HealthCheckHTTPEndpoint:      "/healthz",
+					HealthCheckTimeout:           120,
+					HealthCheckInvocationTimeout: 5,
+					Instances:                    2,
+				},
+			},
+			want: &operation.AppManifest{
+				Name:    "svc",
+				Env:     map[string]string{"FOO": "bar"},
+				NoRoute: true,
+				// the password goes in the package, not the manifest
+				Docker: &operation.AppManifestDocker{Image: "postgres:16", Username: "u"},
+				AppManifestProcess: operation.AppManifestProcess{
+					Command:                      "postgres",
+					Memory:                       "512M",
+					DiskQuota:                    "1024M",
+					HealthCheckType:              "http",
+					HealthCheckHTTPEndpoint:      "/healthz",
+					Timeout:                      120,
+					HealthCheckInvocationTimeout: 5,
+					Instances:                    &two,
+				},
+			},
+		},
+		"honors routes and leaves defaults to CF": {
+			manifest: &AppManifest{Name: "svc", Docker: AppManifestDocker{Image: "postgres:16"}},
+			want: &operation.AppManifest{
+				Name:   "svc",
+				Docker: &operation.AppManifestDocker{Image: "postgres:16"},
+			},
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if diff := cmp.Diff(toCFManifest(tt.manifest), tt.want); diff != "" {
+				t.Errorf("mismatch (-got +want):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestCFClientAPI_appsListFiltered(t *testing.T) {
+	cf := newFakeCF(t)
+	api := &CFClientAPI{}
+	if err := api.connect(context.Background(), cf.URL, &Creds{Username: "u", Password: "p"}); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := api.appsListFiltered(context.Background(), &AppsFilter{
+		SpaceGUIDs: []string{"space-guid"},
+		Names:      []string{"svc", "worker"},
+		Labels:     map[string]string{"job": "42"},
+	})
+	if err != nil {
+		t.Fatalf("appsListFiltered() error = %v", err)
+	}
+	if diff := cmp.Diff(got, []*App{{Name: "svc", GUID: "app-guid", State: "STARTED", SpaceGUID: "space-guid"}}); diff != "" {
+		t.Errorf("mismatch (-got +want):\n%s", diff)
+	}
+
+	if _, err := api.appsListFiltered(context.Background(), &AppsFilter{Labels: map[string]string{"job": ""}}); err != nil {
+		t.Fatalf("appsListFiltered() error = %v", err)
+	}
+
+	want := []url.Values{
+		{
+			"page":           {"1"},
+			"per_page":       {"50"},
+			"space_guids":    {"space-guid"},
+			"names":          {"svc,worker"},
+			"label_selector": {"job=42"},
+		},
+		{"page": {"1"}, "per_page": {"50"}, "label_selector": {"job"}},
+	}
+	if diff := cmp.Diff(cf.appReads, want); diff != "" {
+		t.Errorf("query mismatch (-got +want):\n%s", diff)
+	}
+}
+
+// policy_client's requests have to go through ctx for its failures to
+// become APIErrors.
+func Test_ctxHTTPClient(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Vcap-Request-Id", "req-id")
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer srv.Close()
+
+	ctx, info := withResponseInfo(context.Background())
+	c := ctxHTTPClient{ctx: ctx, client: &http.Client{Transport: newResponseInfoTransport()}}
+
+	req, err := http.NewRequest(http.MethodPost, srv.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := c.Do(req)
+	if err != nil {
+		t.Fatalf("Do() error = %v", err)
+	}
+	res.Body.Close()
+
+	err = toAPIError(errors.New("policy denied"), info)
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.Kind != ErrUnauthorized || apiErr.RequestID != "req-id" {
+		t.Errorf("error = %#v, want an ErrUnauthorized APIError for req-id", err)
+	}
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	c.ctx = cancelled
+	if _, err = c.Do(req); !errors.Is(err, context.Canceled) {
+		t.Errorf("Do() error = %v, want %v", err, context.Canceled)
+	}
+}
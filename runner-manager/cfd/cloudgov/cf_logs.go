@@ -0,0 +1,127 @@
+package cloudgov
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// logCacheURL looks up where the API's log cache is, once per client.
+func (cf *CFClientAPI) logCacheURL(ctx context.Context) (string, error) {
+	cf.mu.Lock()
+	defer cf.mu.Unlock()
+
+	if cf.logCache != "" {
+		return cf.logCache, nil
+	}
+
+	root, err := cf.conn().Root.Get(ctx)
+	if err != nil {
+		return "", err
+	}
+	if root.Links.LogCache.Href == "" {
+		return "", errors.New("CF API doesn't link to a log cache")
+	}
+
+	cf.logCache = strings.TrimSuffix(root.Links.LogCache.Href, "/")
+	return cf.logCache, nil
+}
+
+// appLogs reads an app's log envelopes from log cache's read API.
+//
+// See: https://github.com/cloudfoundry/log-cache-release/tree/main/src#get-apiv1readsource-id
+func (cf *CFClientAPI) appLogs(ctx context.Context, id string, q logsQuery) (_ []*LogLine, err error) {
+	ctx, info := withResponseInfo(ctx)
+	defer func() { err = toAPIError(err, info) }()
+
+	base, err := cf.logCacheURL(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	query := url.Values{"envelope_types": {"LOG"}}
+	if !q.start.IsZero() {
+		query.Set("start_time", strconv.FormatInt(q.start.UnixNano(), 10))
+	}
+	if q.limit > 0 {
+		query.Set("limit", strconv.Itoa(q.limit))
+	}
+	if q.descending {
+		query.Set("descending", "true")
+	}
+
+	req, err := http.NewRequestWithContext(
+		ctx, http.MethodGet, base+"/api/v1/read/"+url.PathEscape(id)+"?"+query.Encode(), nil,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := cf.conn().ExecuteAuthRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	return parseLogEnvelopes(body)
+}
+
+// parseLogEnvelopes reads the log lines from a log cache read response,
+// skipping any envelopes that aren't logs.
+func parseLogEnvelopes(body []byte) ([]*LogLine, error) {
+	var r struct {
+		Envelopes struct {
+			Batch []struct {
+				// int64s come as strings, as log cache's JSON is from protobuf
+				Timestamp  json.Number       `json:"timestamp"`
+				InstanceID string            `json:"instance_id"`
+				Tags       map[string]string `json:"tags"`
+				Log        *struct {
+					Payload []byte `json:"payload"`
+					Type    string `json:"type"`
+				} `json:"log"`
+			} `json:"batch"`
+		} `json:"envelopes"`
+	}
+	if err := json.Unmarshal(body, &r); err != nil {
+		return nil, fmt.Errorf("error parsing log envelopes: %w", err)
+	}
+
+	var lines []*LogLine
+	for _, e := range r.Envelopes.Batch {
+		if e.Log == nil {
+			continue
+		}
+
+		ns, err := e.Timestamp.Int64()
+		if err != nil {
+			return nil, fmt.Errorf("error parsing log envelope timestamp %q: %w", e.Timestamp, err)
+		}
+
+		// OUT is protobuf's zero value, so it's left out
+		stream := e.Log.Type
+		if stream == "" {
+			stream = "OUT"
+		}
+
+		lines = append(lines, &LogLine{
+			Time:     time.Unix(0, ns),
+			Source:   e.Tags["source_type"],
+			Instance: e.InstanceID,
+			Stream:   stream,
+			Message:  strings.TrimRight(string(e.Log.Payload), "\r\n"),
+		})
+	}
+	return lines, nil
+}
@@ -0,0 +1,159 @@
+package cloudgov
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/cloudfoundry/go-cfclient/v3/client"
+	"github.com/cloudfoundry/go-cfclient/v3/operation"
+	"github.com/cloudfoundry/go-cfclient/v3/resource"
+	"gopkg.in/yaml.v3"
+)
+
+// pushPollInterval is how often we check on manifest jobs and builds.
+var pushPollInterval = time.Second
+
+// appPush does what go-cfclient's operation.AppPushOperation.Push does
+// for docker apps, but puts registry credentials in the package we
+// create. op.Push only reads the password from CF_DOCKER_PASSWORD, which
+// is shared by the whole process and anything it runs.
+func (cf *CFClientAPI) appPush(ctx context.Context, m *AppManifest) (_ *App, err error) {
+	ctx, info := withResponseInfo(ctx)
+	defer func() { err = toAPIError(err, info) }()
+
+	space, err := cf.findSpace(ctx, m.OrgName, m.SpaceName)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = cf.applyManifest(ctx, space, toCFManifest(m)); err != nil {
+		return nil, err
+	}
+
+	app, err := cf.findApp(ctx, space.GUID, m.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	// an empty username and password are left out, for public images
+	newPkg := resource.NewDockerPackageCreate(app.GUID, m.Docker.Image, m.Docker.Username, m.Docker.Password)
+	pkg, err := cf.conn().Packages.Create(ctx, newPkg)
+	if err != nil {
+		return nil, fmt.Errorf("error creating docker package for app %s: %w", m.Name, err)
+	}
+
+	newBuild := resource.NewBuildCreate(pkg.GUID)
+	newBuild.Lifecycle = &resource.Lifecycle{Type: resource.LifecycleDocker.String()}
+	build, err := cf.conn().Builds.Create(ctx, newBuild)
+	if err != nil {
+		return nil, fmt.Errorf("error creating build for app %s: %w", m.Name, err)
+	}
+
+	build, err = cf.waitForBuild(ctx, build.GUID)
+	if err != nil {
+		return nil, fmt.Errorf("error staging app %s: %w", m.Name, err)
+	}
+
+	if build.Droplet == nil {
+		return nil, fmt.Errorf("error staging app %s: build %s has no droplet", m.Name, build.GUID)
+	}
+
+	if len(m.Process.Args) > 0 {
+		if err = cf.setEntrypointArgs(ctx, app.GUID, build.Droplet.GUID, m.Process.Args); err != nil {
+			return nil, fmt.Errorf("error setting start command for app %s: %w", m.Name, err)
+		}
+	}
+	_, err = cf.conn().Droplets.SetCurrentAssociationForApp(ctx, app.GUID, build.Droplet.GUID)
+	if err != nil {
+		return nil, fmt.Errorf("error setting droplet for app %s: %w", m.Name, err)
+	}
+
+	app, err = cf.conn().Applications.Start(ctx, app.GUID)
+	if err != nil {
+		return nil, fmt.Errorf("error starting app %s: %w", m.Name, err)
+	}
+	return castApp(app), nil
+}
+
+func (cf *CFClientAPI) applyManifest(ctx context.Context, space *Space, m *operation.AppManifest) error {
+	// the API wants an applications array, like a manifest.yml
+	manifest, err := yaml.Marshal(&operation.Manifest{Applications: []*operation.AppManifest{m}})
+	if err != nil {
+		return fmt.Errorf("error marshalling manifest for app %s: %w", m.Name, err)
+	}
+
+	jobGUID, err := cf.conn().Manifests.ApplyManifest(ctx, space.GUID, string(manifest))
+	if err != nil {
+		return fmt.Errorf("error applying manifest for app %s: %w", m.Name, err)
+	}
+
+	opts := client.NewPollingOptions()
+	opts.CheckInterval = pushPollInterval
+	if err = cf.conn().Jobs.PollComplete(ctx, jobGUID, opts); err != nil {
+		return fmt.Errorf("error applying manifest for app %s: %w", m.Name, err)
+	}
+	return nil
+}
+
+// setEntrypointArgs sets the app's start command to args following the
+// ENTRYPOINT staging found in the image, as docker runs a command
+// without an entrypoint. We can't leave it to the image, as CF would run
+// the image's CMD instead.
+func (cf *CFClientAPI) setEntrypointArgs(ctx context.Context, appGUID string, dropletGUID string, args []string) error {
+	droplet, err := cf.conn().Droplets.Get(ctx, dropletGUID)
+	if err != nil {
+		return err
+	}
+	entrypoint, err := parseEntrypoint(droplet.ExecutionMetadata)
+	if err != nil {
+		return err
+	}
+
+	opts := client.NewProcessOptions()
+	opts.Types.EqualTo("web")
+	proc, err := cf.conn().Processes.SingleForApp(ctx, appGUID, opts)
+	if err != nil {
+		return err
+	}
+
+	command := StartCommand(entrypoint, args)
+	_, err = cf.conn().Processes.Update(ctx, proc.GUID, &resource.ProcessUpdate{Command: &command})
+	return err
+}
+
+// waitForBuild polls build guid until it's staged, returning an
+// ErrStagingFailed APIError with CF's reason if it fails. We don't time
+// out ourselves, CF fails builds that stage for too long.
+func (cf *CFClientAPI) waitForBuild(ctx context.Context, guid string) (*resource.Build, error) {
+	ticker := time.NewTicker(pushPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+
+		build, err := cf.conn().Builds.Get(ctx, guid)
+		if err != nil {
+			return nil, err
+		}
+
+		switch build.State {
+		case resource.BuildStateStaged:
+			return build, nil
+		case resource.BuildStateFailed:
+			detail := "unknown error"
+			if build.Error != nil {
+				detail = *build.Error
+			}
+			return nil, &APIError{
+				Kind:   ErrStagingFailed,
+				Detail: detail,
+				Err:    fmt.Errorf("build %s failed: %s", guid, detail),
+			}
+		}
+	}
+}
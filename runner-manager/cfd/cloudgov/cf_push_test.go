@@ -0,0 +1,275 @@
+package cloudgov
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// fakeCF answers just enough of the v3 API to push a docker app, find
+// it, and read its logs, recording the packages and queries it gets.
+type fakeCF struct {
+	*httptest.Server
+	t           *testing.T
+	buildState  string
+	buildError  string
+	logs        string // log cache read response
+	dropletMeta string // the droplet's execution_metadata
+
+	mu        sync.Mutex
+	packages  []map[string]any
+	logReads  []url.Values
+	appReads  []url.Values
+	commands  []string       // start commands set on the web process
+	cfReads   map[string]int // org and space lookups, by path
+	rootReads int
+	envSeen   bool // CF_DOCKER_PASSWORD was set while handling a request
+}
+
+func newFakeCF(t *testing.T) *fakeCF {
+	f := &fakeCF{t: t, buildState: "STAGED"}
+	f.Server = httptest.NewServer(http.HandlerFunc(f.serve))
+	t.Cleanup(f.Close)
+	return f
+}
+
+func (f *fakeCF) serve(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	if _, ok := os.LookupEnv("CF_DOCKER_PASSWORD"); ok {
+		f.envSeen = true
+	}
+	f.mu.Unlock()
+
+	app := `{"guid":"app-guid","name":"svc","state":"STARTED","lifecycle":{"type":"docker"},` +
+		`"relationships":{"space":{"data":{"guid":"space-guid"}}}}`
+	list := func(res string) string {
+		return `{"pagination":{"total_results":1,"total_pages":1},"resources":[` + res + `]}`
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	switch route := r.Method + " " + r.URL.Path; route {
+	case "GET /":
+		f.mu.Lock()
+		f.rootReads++
+		f.mu.Unlock()
+		fmt.Fprintf(w, `{"links":{"login":{"href":%q},"uaa":{"href":%q},"log_cache":{"href":%q}}}`,
+			f.URL, f.URL, f.URL)
+	case "POST /oauth/token":
+		fmt.Fprint(w, `{"access_token":"token","token_type":"bearer","expires_in":3600}`)
+	case "GET /v3/organizations", "GET /v3/spaces", "GET /v3/spaces/space-guid", "GET /v3/spaces/nope":
+		f.mu.Lock()
+		if f.cfReads == nil {
+			f.cfReads = map[string]int{}
+		}
+		f.cfReads[r.URL.Path]++
+		f.mu.Unlock()
+		f.serveSpaces(w, r)
+	case "POST /v3/spaces/space-guid/actions/apply_manifest":
+		w.Header().Set("Location", f.URL+"/v3/jobs/job-guid")
+		w.WriteHeader(http.StatusAccepted)
+	case "GET /v3/jobs/job-guid":
+		fmt.Fprint(w, `{"guid":"job-guid","state":"COMPLETE"}`)
+	case "GET /v3/apps":
+		f.mu.Lock()
+		f.appReads = append(f.appReads, r.URL.Query())
+		f.mu.Unlock()
+		fmt.Fprint(w, list(app))
+	case "POST /v3/packages":
+		var pkg map[string]any
+		body, _ := io.ReadAll(r.Body)
+		if err := json.Unmarshal(body, &pkg); err != nil {
+			f.t.Errorf("error reading package: %v", err)
+		}
+		f.mu.Lock()
+		f.packages = append(f.packages, pkg)
+		f.mu.Unlock()
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprint(w, `{"guid":"pkg-guid","type":"docker","data":{}}`)
+	case "POST /v3/builds":
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprint(w, `{"guid":"build-guid","state":"STAGING"}`)
+	case "GET /v3/builds/build-guid":
+		fmt.Fprintf(w, `{"guid":"build-guid","state":%q,"error":%q,"droplet":{"guid":"droplet-guid"}}`,
+			f.buildState, f.buildError)
+	case "PATCH /v3/apps/app-guid/relationships/current_droplet":
+		fmt.Fprint(w, `{"data":{"guid":"droplet-guid"}}`)
+	case "GET /v3/droplets/droplet-guid":
+		fmt.Fprintf(w, `{"guid":"droplet-guid","state":"STAGED","execution_metadata":%q}`, f.dropletMeta)
+	case "GET /v3/apps/app-guid/processes":
+		if types := r.URL.Query().Get("types"); types != "web" {
+			f.t.Errorf("listed processes of types %q, want web", types)
+		}
+		fmt.Fprint(w, list(`{"guid":"web-guid","type":"web"}`))
+	case "PATCH /v3/processes/web-guid":
+		var update struct{ Command string }
+		body, _ := io.ReadAll(r.Body)
+		if err := json.Unmarshal(body, &update); err != nil {
+			f.t.Errorf("error reading process update: %v", err)
+		}
+		f.mu.Lock()
+		f.commands = append(f.commands, update.Command)
+		f.mu.Unlock()
+		fmt.Fprint(w, `{"guid":"web-guid","type":"web"}`)
+	case "POST /v3/apps/app-guid/actions/start":
+		fmt.Fprint(w, app)
+	case "GET /api/v1/read/app-guid":
+		f.mu.Lock()
+		f.logReads = append(f.logReads, r.URL.Query())
+		f.mu.Unlock()
+		fmt.Fprint(w, f.logs)
+	default:
+		f.t.Errorf("unexpected request %v", route)
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// serveSpaces finds org "org" and space "space", by name or GUID.
+func (f *fakeCF) serveSpaces(w http.ResponseWriter, r *http.Request) {
+	list := func(name string, res string) {
+		if n := r.URL.Query().Get("names"); n != name {
+			res = ""
+		}
+		fmt.Fprint(w, `{"pagination":{"total_results":1,"total_pages":1},"resources":[`+res+`]}`)
+	}
+
+	switch r.URL.Path {
+	case "/v3/organizations":
+		list("org", `{"guid":"org-guid","name":"org"}`)
+	case "/v3/spaces":
+		list("space", `{"guid":"space-guid","name":"space"}`)
+	case "/v3/spaces/space-guid":
+		fmt.Fprint(w, `{"guid":"space-guid","name":"space",`+
+			`"relationships":{"organization":{"data":{"guid":"org-guid"}}},`+
+			`"included":{"organizations":[{"guid":"org-guid","name":"org"}]}}`)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"errors":[{"code":10010,"title":"CF-ResourceNotFound","detail":"Space not found"}]}`)
+	}
+}
+
+func TestCFClientAPI_appPush(t *testing.T) {
+	defer func(d time.Duration) { pushPollInterval = d }(pushPollInterval)
+	pushPollInterval = time.Millisecond
+
+	tests := map[string]struct {
+		docker       AppManifestDocker
+		args         []string
+		dropletMeta  string
+		buildState   string
+		wantData     map[string]any
+		wantCommands []string
+		wantErr      error
+		wantErrText  string
+	}{
+		"passes credentials in the package": {
+			docker: AppManifestDocker{Image: "registry.example.com/svc:1", Username: "user", Password: "secret"},
+			wantData: map[string]any{
+				"image":    "registry.example.com/svc:1",
+				"username": "user",
+				"password": "secret",
+			},
+		},
+		"leaves out credentials for public images": {
+			docker:   AppManifestDocker{Image: "postgres:16"},
+			wantData: map[string]any{"image": "postgres:16"},
+		},
+		"passes a command alone to the image's entrypoint": {
+			docker:       AppManifestDocker{Image: "postgres:16"},
+			args:         []string{"postgres", "-c", "fsync=off"},
+			dropletMeta:  `{"entrypoint":["docker-entrypoint.sh"],"cmd":["postgres"]}`,
+			wantData:     map[string]any{"image": "postgres:16"},
+			wantCommands: []string{"docker-entrypoint.sh postgres -c fsync=off"},
+		},
+		"runs a command alone without an image entrypoint": {
+			docker:       AppManifestDocker{Image: "redis:7"},
+			args:         []string{"redis-server", "--save", ""},
+			dropletMeta:  `{"cmd":["redis-server"]}`,
+			wantData:     map[string]any{"image": "redis:7"},
+			wantCommands: []string{"redis-server --save ''"},
+		},
+		"fails without the image's entrypoint": {
+			docker:      AppManifestDocker{Image: "postgres:16"},
+			args:        []string{"postgres"},
+			wantErrText: "error setting start command for app svc",
+		},
+		"reports staging failures": {
+			docker:      AppManifestDocker{Image: "postgres:16"},
+			buildState:  "FAILED",
+			wantErr:     ErrStagingFailed,
+			wantErrText: "StagingError - image not found",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			// t.Setenv restores it after, we only need it unset during
+			t.Setenv("CF_DOCKER_PASSWORD", "")
+			os.Unsetenv("CF_DOCKER_PASSWORD")
+
+			cf := newFakeCF(t)
+			if tt.buildState != "" {
+				cf.buildState = tt.buildState
+				cf.buildError = "StagingError - image not found"
+			}
+			cf.dropletMeta = tt.dropletMeta
+
+			api := &CFClientAPI{}
+			if err := api.connect(context.Background(), cf.URL, &Creds{Username: "u", Password: "p"}); err != nil {
+				t.Fatal(err)
+			}
+
+			app, err := api.appPush(context.Background(), &AppManifest{
+				Name:      "svc",
+				OrgName:   "org",
+				SpaceName: "space",
+				Docker:    tt.docker,
+				Process:   AppManifestProcess{Args: tt.args},
+			})
+
+			if _, ok := os.LookupEnv("CF_DOCKER_PASSWORD"); ok || cf.envSeen {
+				t.Error("appPush() set CF_DOCKER_PASSWORD")
+			}
+
+			if tt.wantErrText != "" {
+				if err == nil {
+					t.Fatalf("appPush() succeeded, want error %q", tt.wantErrText)
+				}
+				if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+					t.Fatalf("appPush() error = %v, want %v", err, tt.wantErr)
+				}
+				if !strings.Contains(err.Error(), tt.wantErrText) {
+					t.Errorf("appPush() error = %v, want it to contain %q", err, tt.wantErrText)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("appPush() error = %v", err)
+			}
+			if app == nil || app.GUID != "app-guid" {
+				t.Errorf("appPush() = %+v, want app-guid", app)
+			}
+
+			if len(cf.packages) != 1 {
+				t.Fatalf("created %v packages, want 1", len(cf.packages))
+			}
+			if diff := cmp.Diff(cf.packages[0]["data"], any(tt.wantData)); diff != "" {
+				t.Errorf("package data mismatch (-got +want):\n%s", diff)
+			}
+			if diff := cmp.Diff(cf.commands, tt.wantCommands); diff != "" {
+				t.Errorf("start commands mismatch (-got +want):\n%s", diff)
+			}
+		})
+	}
+}
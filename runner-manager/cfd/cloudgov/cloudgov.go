@@ -1,19 +1,38 @@
 // Package cloudgov provides methods to interact CloudFoundry on cloud.gov.
 package cloudgov
 
-import "context"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+)
 
 type ClientAPI interface {
-	connect(url string, creds *Creds) error
+	connect(ctx context.Context, url string, creds *Creds) error
+
+	appGet(ctx context.Context, id string) (*App, error)
+	appFind(ctx context.Context, orgName string, spaceName string, name string) (*App, error)
+	appFindInSpace(ctx context.Context, spaceGUID string, name string) (*App, error)
+	appPush(ctx context.Context, m *AppManifest) (*App, error)
+	appDelete(ctx context.Context, id string) error
+	appsList(ctx context.Context) (apps []*App, err error)
+	appsListFiltered(ctx context.Context, f *AppsFilter) ([]*App, error)
+	appExposedPorts(ctx context.Context, id string) ([]int, error)
+	appInstances(ctx context.Context, id string) ([]*AppInstance, error)
+	appCrashes(ctx context.Context, id string) ([]*AppCrash, error)
+	appLogs(ctx context.Context, id string, q logsQuery) ([]*LogLine, error)
 
-	appGet(id string) (*App, error)
-	appPush(m *AppManifest) (*App, error)
-	appDelete(id string) error
-	appsList() (apps []*App, err error)
+	spaceFind(ctx context.Context, orgName string, spaceName string) (*Space, error)
+	spaceGet(ctx context.Context, guid string) (*Space, error)
 
-	sshCode() (string, error)
+	sshCode(ctx context.Context) (string, error)
 	mapRoute(ctx context.Context, app *App, domain string, space string, host string, path string, port int) error
-	addNetworkPolicy(fromGUID string, toGUID string, portRanges []string) error
+	deleteAppRoutes(ctx context.Context, appGUID string) error
+	addNetworkPolicy(ctx context.Context, fromGUID string, toGUID string, portRanges []string) error
+	removeNetworkPolicies(ctx context.Context, guid string) error
 }
 
 type CredsGetter interface {
@@ -25,11 +44,16 @@ type Opts struct {
 	Creds *Creds
 
 	APIRootURL string
+
+	// Retry transient API failures, nil to not retry
+	Retry *RetryOpts
 }
 
 type Client struct {
 	ClientAPI
 	*Opts
+
+	spaces spaceCache
 }
 
 type CloudGovClientError struct {
@@ -45,12 +69,15 @@ const (
 	internalDomainGUID = "8a5d6a8c-cfc1-4fc4-afc9-aa563ff9df5e"
 )
 
-func New(i ClientAPI, o *Opts) (*Client, error) {
+func New(ctx context.Context, i ClientAPI, o *Opts) (*Client, error) {
 	if o == nil {
 		o = &Opts{CredsGetter: EnvCredsGetter{}}
 	}
+	if o.Retry != nil {
+		i = newRetryClientAPI(i, *o.Retry)
+	}
 	cg := &Client{ClientAPI: i, Opts: o}
-	return cg.Connect()
+	return cg.Connect(ctx)
 }
 
 func (c *Client) apiRootURL() string {
@@ -67,12 +94,12 @@ func (c *Client) creds() (*Creds, error) {
 	return c.Creds, nil
 }
 
-func (c *Client) Connect() (*Client, error) {
+func (c *Client) Connect(ctx context.Context) (*Client, error) {
 	creds, err := c.creds()
 	if err != nil {
 		return nil, err
 	}
-	if err := c.connect(c.apiRootURL(), creds); err != nil {
+	if err := c.connect(ctx, c.apiRootURL(), creds); err != nil {
 		return nil, err
 	}
 	return c, nil
@@ -85,19 +112,74 @@ type App struct {
 	SpaceGUID string
 }
 
-func (c *Client) AppGet(id string) (*App, error) {
-	return c.appGet(id)
+func (c *Client) AppGet(ctx context.Context, id string) (*App, error) {
+	return c.appGet(ctx, id)
+}
+
+// AppFind gets the app with name in the given org and space.
+func (c *Client) AppFind(ctx context.Context, orgName string, spaceName string, name string) (*App, error) {
+	if orgName == "" || spaceName == "" || name == "" {
+		return nil, CloudGovClientError{"AppFind: org, space, and app names must be defined"}
+	}
+	return c.appFind(ctx, orgName, spaceName, name)
+}
+
+// AppFindInSpace gets the app with name in the space with spaceGUID,
+// failing with ErrNotFound if there isn't one.
+func (c *Client) AppFindInSpace(ctx context.Context, spaceGUID string, name string) (*App, error) {
+	if spaceGUID == "" || name == "" {
+		return nil, CloudGovClientError{"AppFindInSpace: space GUID and app name must be defined"}
+	}
+	return c.appFindInSpace(ctx, spaceGUID, name)
 }
 
-func (c *Client) AppDelete(id string) error {
-	return c.appDelete(id)
+func (c *Client) AppDelete(ctx context.Context, id string) error {
+	return c.appDelete(ctx, id)
 }
 
-func (c *Client) AppsList() ([]*App, error) {
-	return c.appsList()
+func (c *Client) AppsList(ctx context.Context) ([]*App, error) {
+	return c.appsList(ctx)
 }
 
-func (c *Client) Push(manifest *AppManifest) (*App, error) {
+// AppsFilter narrows AppsListFiltered, empty fields match any app. CF
+// filters on all but NamePrefix, which it has no query for, so we check
+// that on what CF returns. NamePrefix needs SpaceGUIDs or Labels too so
+// we never page through every app we can see just to drop most of them.
+type AppsFilter struct {
+	SpaceGUIDs []string
+	Names      []string
+	NamePrefix string
+	// Labels apps must have, e.g., {"job": "42"}, "" for any value
+	Labels map[string]string
+}
+
+// AppsListFiltered lists the apps matching f.
+func (c *Client) AppsListFiltered(ctx context.Context, f *AppsFilter) ([]*App, error) {
+	if f == nil {
+		f = &AppsFilter{}
+	}
+	if f.NamePrefix != "" && len(f.SpaceGUIDs) < 1 && len(f.Labels) < 1 {
+		return nil, CloudGovClientError{"AppsListFiltered: NamePrefix needs SpaceGUIDs or Labels"}
+	}
+
+	apps, err := c.appsListFiltered(ctx, f)
+	if err != nil {
+		return nil, err
+	}
+	if f.NamePrefix != "" {
+		apps = slices.DeleteFunc(apps, func(app *App) bool {
+			return app == nil || !strings.HasPrefix(app.Name, f.NamePrefix)
+		})
+	}
+	return apps, nil
+}
+
+// AppExposedPorts lists the ports a docker app's image declares with EXPOSE.
+func (c *Client) AppExposedPorts(ctx context.Context, app *App) ([]int, error) {
+	return c.appExposedPorts(ctx, app.GUID)
+}
+
+func (c *Client) Push(ctx context.Context, manifest *AppManifest) (*App, error) {
 	// TODO: this abstraction might belong in /cmd,
 	// unless it can be further generalized to all pushes
 	containerID := manifest.Name
@@ -110,41 +192,79 @@ func (c *Client) Push(manifest *AppManifest) (*App, error) {
 		return nil, CloudGovClientError{"Push: AppManifest must have Org and Space names"}
 	}
 
-	return c.appPush(manifest)
+	return c.appPush(ctx, manifest)
 }
 
-func (c *Client) ServicesPush(manifests []*AppManifest) ([]*App, error) {
-	// TODO: use this in prepare or get rid of it
+const servicesPushLimitDefault = 4
+
+// ServicesPush pushes manifests concurrently, at most limit at a time
+// (or a default if limit < 1). Apps are returned in the same order as
+// manifests, nil where that push failed, along with every push error.
+func (c *Client) ServicesPush(ctx context.Context, manifests []*AppManifest, limit int) ([]*App, error) {
 	if len(manifests) < 1 {
 		return nil, nil
 	}
+	if limit < 1 {
+		limit = servicesPushLimitDefault
+	}
 
 	apps := make([]*App, len(manifests))
+	errs := make([]error, len(manifests))
 
-	for i, s := range manifests {
-		app, err := c.Push(s)
-		if err != nil {
-			return nil, err
-		}
-		apps[i] = app
+	sem := make(chan struct{}, limit)
+	var wg sync.WaitGroup
+
+	for i, m := range manifests {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			// don't start pushes that are still queued once we're cancelled
+			select {
+			case sem <- struct{}{}:
+				defer func() { <-sem }()
+			case <-ctx.Done():
+				errs[i] = fmt.Errorf("error pushing %v: %w", m.Name, ctx.Err())
+				return
+			}
+
+			app, err := c.Push(ctx, m)
+			if err != nil {
+				errs[i] = fmt.Errorf("error pushing %v: %w", m.Name, err)
+				return
+			}
+			apps[i] = app
+		}()
 	}
+	wg.Wait()
 
-	return apps, nil
+	return apps, errors.Join(errs...)
 }
 
-func (c *Client) SSHCode() (string, error) {
-	return c.sshCode()
+func (c *Client) SSHCode(ctx context.Context) (string, error) {
+	return c.sshCode(ctx)
 }
 
-func (c *Client) MapServiceRoute(app *App) error {
+func (c *Client) MapServiceRoute(ctx context.Context, app *App) error {
 	return c.mapRoute(
-		context.Background(), app, internalDomainGUID, app.SpaceGUID, app.Name, "", 0,
+		ctx, app, internalDomainGUID, app.SpaceGUID, app.Name, "", 0,
 	)
 }
 
+// DeleteAppRoutes deletes every route mapped to app, e.g., the internal
+// route made by MapServiceRoute.
+func (c *Client) DeleteAppRoutes(ctx context.Context, app *App) error {
+	return c.deleteAppRoutes(ctx, app.GUID)
+}
+
 // AddNetworkPolicy opens portRanges (e.g. "80", "80-85") on toApp for fromApp.
 func (c *Client) AddNetworkPolicy(
-	fromApp *App, toApp *App, portRanges []string,
+	ctx context.Context, fromApp *App, toApp *App, portRanges []string,
 ) error {
-	return c.addNetworkPolicy(fromApp.GUID, toApp.GUID, portRanges)
+	return c.addNetworkPolicy(ctx, fromApp.GUID, toApp.GUID, portRanges)
+}
+
+// RemoveNetworkPolicies removes every policy app is a source or destination of.
+func (c *Client) RemoveNetworkPolicies(ctx context.Context, app *App) error {
+	return c.removeNetworkPolicies(ctx, app.GUID)
 }
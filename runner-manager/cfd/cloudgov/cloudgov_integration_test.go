@@ -3,6 +3,7 @@
 package cloudgov_test
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -47,7 +48,7 @@ func Test_CFAdapter_AppGet(t *testing.T) {
 		State: "STARTED",
 	}}
 
-	got, err := cgClient.AppsList()
+	got, err := cgClient.AppsList(context.Background())
 	if err != nil {
 		t.Fatalf("Error running AppsList() = %v", err)
 	}
@@ -88,7 +89,7 @@ func Test_Push(t *testing.T) {
 	for name, tt := range tests {
 		t.Run(name, func(t *testing.T) {
 			c := cgClient
-			got, err := c.Push(tt.manifest)
+			got, err := c.Push(context.Background(), tt.manifest)
 
 			if got != nil && got.GUID != "" {
 				tutils.CleanupApp(t, c, got.GUID)
@@ -108,7 +109,7 @@ func Test_Push(t *testing.T) {
 
 func Test_SSHCode(t *testing.T) {
 	setup(t)
-	got, err := cgClient.SSHCode()
+	got, err := cgClient.SSHCode(context.Background())
 	if err != nil {
 		t.Errorf("got error = %v", err)
 		return
@@ -145,13 +146,13 @@ func cleanupRoute(t testing.TB, app *cg.App) error {
 func TestClient_MapServiceRoute(t *testing.T) {
 	setup(t)
 
-	apps, err := cgClient.AppsList()
+	apps, err := cgClient.AppsList(context.Background())
 	if err != nil {
 		t.Fatal(err)
 	}
 	app := apps[0]
 
-	err = cgClient.MapServiceRoute(app)
+	err = cgClient.MapServiceRoute(context.Background(), app)
 	defer cleanupRoute(t, app)
 	if err != nil {
 		t.Fatal(err)
@@ -225,7 +226,7 @@ func getNetPolicyRe(elems ...any) *regexp.Regexp {
 func TestClient_AddNetworkPolicy(t *testing.T) {
 	setup(t)
 
-	apps, err := cgClient.AppsList()
+	apps, err := cgClient.AppsList(context.Background())
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -234,7 +235,7 @@ func TestClient_AddNetworkPolicy(t *testing.T) {
 	}
 
 	pranges := []string{"80-85", "443"}
-	err = cgClient.AddNetworkPolicy(apps[0], apps[1], pranges)
+	err = cgClient.AddNetworkPolicy(context.Background(), apps[0], apps[1], pranges)
 	defer cleanupNetPolicy(t, apps[0], apps[1], pranges)
 	if err != nil {
 		t.Fatal(err)
@@ -1,8 +1,13 @@
 package cloudgov
 
 import (
+	"context"
 	"errors"
+	"slices"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
@@ -11,9 +16,10 @@ import (
 type stubClientAPI struct {
 	ClientAPI
 
-	StURL   string
-	StCreds *Creds
-	StApps  []*App
+	StURL    string
+	StCreds  *Creds
+	StApps   []*App
+	StFilter *AppsFilter
 
 	FailConnect   bool
 	FailAppsList  bool
@@ -34,7 +40,7 @@ func (e *testErr) Is(err error) bool {
 	return e.Error() == err.Error()
 }
 
-func (a *stubClientAPI) connect(url string, creds *Creds) (_ error) {
+func (a *stubClientAPI) connect(ctx context.Context, url string, creds *Creds) (_ error) {
 	if a.FailConnect {
 		return &testErr{"fail"}
 	}
@@ -43,14 +49,14 @@ func (a *stubClientAPI) connect(url string, creds *Creds) (_ error) {
 	return nil
 }
 
-func (a *stubClientAPI) appGet(id string) (*App, error) {
+func (a *stubClientAPI) appGet(ctx context.Context, id string) (*App, error) {
 	if id == "" || a.FailAppFound {
 		return nil, nil
 	}
 	return &App{Name: id}, nil
 }
 
-func (a *stubClientAPI) appDelete(id string) error {
+func (a *stubClientAPI) appDelete(ctx context.Context, id string) error {
 	if id == "" {
 		return &testErr{"Need an App ID to delete"}
 	}
@@ -60,7 +66,7 @@ func (a *stubClientAPI) appDelete(id string) error {
 	return nil
 }
 
-func (a *stubClientAPI) appPush(m *AppManifest) (*App, error) {
+func (a *stubClientAPI) appPush(ctx context.Context, m *AppManifest) (*App, error) {
 	if a.FailAppPush {
 		return nil, &testErr{"FailAppPush"}
 	}
@@ -70,13 +76,21 @@ func (a *stubClientAPI) appPush(m *AppManifest) (*App, error) {
 	return &App{Name: m.Name, State: "TEST"}, nil
 }
 
-func (a *stubClientAPI) appsList() (apps []*App, err error) {
+func (a *stubClientAPI) appsList(ctx context.Context) (apps []*App, err error) {
 	if a.FailAppsList {
 		return nil, &testErr{"FailAppsList"}
 	}
 	return a.StApps, nil
 }
 
+func (a *stubClientAPI) appsListFiltered(ctx context.Context, f *AppsFilter) ([]*App, error) {
+	if a.FailAppsList {
+		return nil, &testErr{"FailAppsList"}
+	}
+	a.StFilter = f
+	return a.StApps, nil
+}
+
 type stubCredsGetter struct {
 	U    string
 	P    string
@@ -92,10 +106,10 @@ func (c stubCredsGetter) getCreds() (*Creds, error) {
 
 func TestNew(t *testing.T) {
 	optsStub := &Opts{CredsGetter: stubCredsGetter{"a", "b", false}}
-	cgStub := &Client{&stubClientAPI{
+	cgStub := &Client{ClientAPI: &stubClientAPI{
 		StURL:   apiRootURLDefault,
 		StCreds: &Creds{"a", "b"},
-	}, optsStub}
+	}, Opts: optsStub}
 
 	tests := []struct {
 		want    *Client
@@ -109,7 +123,7 @@ func TestNew(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := New(&stubClientAPI{}, tt.opts)
+			got, err := New(context.Background(), &stubClientAPI{}, tt.opts)
 			if (err == nil) != (tt.wantErr == nil) {
 				t.Errorf("GetCfClient() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -118,7 +132,7 @@ func TestNew(t *testing.T) {
 				t.Errorf("GetCredentials() bad error type: got %T, want %T", err, tt.wantErr)
 				return
 			}
-			if diff := cmp.Diff(got, tt.want); diff != "" {
+			if diff := cmp.Diff(got, tt.want, cmpopts.IgnoreUnexported(Client{})); diff != "" {
 				t.Errorf("mismatch (-got +want):\n%s", diff)
 			}
 		})
@@ -265,7 +279,7 @@ func TestClient_Connect(t *testing.T) {
 				Opts:      tt.fields.Opts,
 			}
 
-			got, err := c.Connect()
+			got, err := c.Connect(context.Background())
 
 			if (err != nil) != tt.wantErr {
 				t.Errorf("Client.Connect() error = %v, wantErr %v", err, tt.wantErr)
@@ -278,7 +292,7 @@ func TestClient_Connect(t *testing.T) {
 				}
 			}
 
-			if diff := cmp.Diff(tt.cmpGet(got), tt.cmpGet(tt.want)); diff != "" {
+			if diff := cmp.Diff(tt.cmpGet(got), tt.cmpGet(tt.want), cmpopts.IgnoreUnexported(Client{})); diff != "" {
 				t.Errorf("mismatch (-got +want):\n%s", diff)
 			}
 		})
@@ -323,7 +337,7 @@ func TestClient_AppsList(t *testing.T) {
 				ClientAPI: tt.fields.ClientAPI,
 				Opts:      tt.fields.Opts,
 			}
-			got, err := c.AppsList()
+			got, err := c.AppsList(context.Background())
 			if (err != nil) != tt.wantErr {
 				t.Errorf("Client.AppsList() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -335,12 +349,78 @@ func TestClient_AppsList(t *testing.T) {
 	}
 }
 
+func TestClient_AppsListFiltered(t *testing.T) {
+	apps := []*App{{Name: "glrw-p1-c0-j42"}, {Name: "glrw-p1-c0-j42-svc-db"}, {Name: "manager"}}
+
+	tests := map[string]struct {
+		filter     *AppsFilter
+		fail       bool
+		want       []*App
+		wantFilter *AppsFilter
+		wantErr    bool
+	}{
+		"lists everything without a filter": {
+			want:       apps,
+			wantFilter: &AppsFilter{},
+		},
+		"leaves filtering to CF": {
+			filter:     &AppsFilter{SpaceGUIDs: []string{"space"}, Labels: map[string]string{"job": "42"}},
+			want:       apps,
+			wantFilter: &AppsFilter{SpaceGUIDs: []string{"space"}, Labels: map[string]string{"job": "42"}},
+		},
+		"filters on name prefixes itself": {
+			filter:     &AppsFilter{SpaceGUIDs: []string{"space"}, NamePrefix: "glrw-p1-c0-j42-"},
+			want:       []*App{{Name: "glrw-p1-c0-j42-svc-db"}},
+			wantFilter: &AppsFilter{SpaceGUIDs: []string{"space"}, NamePrefix: "glrw-p1-c0-j42-"},
+		},
+		"won't filter on name prefixes alone": {
+			filter:  &AppsFilter{NamePrefix: "glrw-p1-c0-j42-"},
+			wantErr: true,
+		},
+		"reports errors": {
+			fail:    true,
+			wantErr: true,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			stub := &stubClientAPI{StApps: slices.Clone(apps), FailAppsList: tt.fail}
+			c := &Client{ClientAPI: stub}
+
+			got, err := c.AppsListFiltered(context.Background(), tt.filter)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Client.AppsListFiltered() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if diff := cmp.Diff(got, tt.want); diff != "" {
+				t.Errorf("mismatch (-got +want):\n%s", diff)
+			}
+			if diff := cmp.Diff(stub.StFilter, tt.wantFilter); diff != "" {
+				t.Errorf("filter mismatch (-got +want):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestClient_AppFindInSpace(t *testing.T) {
+	// the stub would panic if we called through without a space or name
+	c := &Client{ClientAPI: &stubClientAPI{}}
+
+	for _, args := range [][2]string{{"", "worker"}, {"space-guid", ""}} {
+		_, err := c.AppFindInSpace(context.Background(), args[0], args[1])
+		var clientErr CloudGovClientError
+		if !errors.As(err, &clientErr) {
+			t.Errorf("Client.AppFindInSpace(%q, %q) error = %v, want a CloudGovClientError", args[0], args[1], err)
+		}
+	}
+}
+
 func TestClient_Push(t *testing.T) {
 	optsStub := &Opts{CredsGetter: stubCredsGetter{"a", "b", false}}
-	cgStub := &Client{&stubClientAPI{
+	cgStub := &Client{ClientAPI: &stubClientAPI{
 		StURL:   apiRootURLDefault,
 		StCreds: &Creds{"a", "b"},
-	}, optsStub}
+	}, Opts: optsStub}
 
 	type fields struct {
 		ClientAPI ClientAPI
@@ -379,7 +459,7 @@ func TestClient_Push(t *testing.T) {
 				ClientAPI: tt.fields.ClientAPI,
 				Opts:      tt.fields.Opts,
 			}
-			got, err := c.Push(tt.args.manifest)
+			got, err := c.Push(context.Background(), tt.args.manifest)
 			if err != nil || tt.wantErr != nil {
 				if tt.wantErr == nil {
 					t.Errorf("Client.AppsList() error = %v", err)
@@ -394,3 +474,93 @@ func TestClient_Push(t *testing.T) {
 		})
 	}
 }
+
+// countingPushStub tracks how many pushes are in flight at once.
+type countingPushStub struct {
+	stubClientAPI
+
+	mu      sync.Mutex
+	running int
+	maxRun  int
+}
+
+func (a *countingPushStub) appPush(ctx context.Context, m *AppManifest) (*App, error) {
+	a.mu.Lock()
+	a.running++
+	a.maxRun = max(a.maxRun, a.running)
+	a.mu.Unlock()
+
+	time.Sleep(10 * time.Millisecond)
+
+	a.mu.Lock()
+	a.running--
+	a.mu.Unlock()
+
+	return a.stubClientAPI.appPush(ctx, m)
+}
+
+func TestClient_ServicesPush(t *testing.T) {
+	valid := func(name string) *AppManifest {
+		return &AppManifest{Name: name, OrgName: "Some", SpaceName: "Space"}
+	}
+
+	tests := map[string]struct {
+		manifests []*AppManifest
+		limit     int
+		want      []*App
+		wantErrs  []string
+		wantMax   int
+	}{
+		"does nothing without manifests": {},
+		"returns apps in order": {
+			manifests: []*AppManifest{valid("a"), valid("b"), valid("c")},
+			want: []*App{
+				{Name: "a", State: "TEST"},
+				{Name: "b", State: "TEST"},
+				{Name: "c", State: "TEST"},
+			},
+		},
+		"collects every error": {
+			manifests: []*AppManifest{{}, valid("b"), {Name: "c"}},
+			want:      []*App{nil, {Name: "b", State: "TEST"}, nil},
+			wantErrs: []string{
+				"Push: AppManifest.Name must be defined",
+				"error pushing c: Push: AppManifest must have Org and Space names",
+			},
+		},
+		"pushes at most limit at once": {
+			manifests: []*AppManifest{valid("a"), valid("b"), valid("c"), valid("d")},
+			limit:     2,
+			want: []*App{
+				{Name: "a", State: "TEST"},
+				{Name: "b", State: "TEST"},
+				{Name: "c", State: "TEST"},
+				{Name: "d", State: "TEST"},
+			},
+			wantMax: 2,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			stub := &countingPushStub{}
+			c := &Client{ClientAPI: stub, Opts: &Opts{}}
+
+			got, err := c.ServicesPush(context.Background(), tt.manifests, tt.limit)
+			for _, want := range tt.wantErrs {
+				if err == nil || !strings.Contains(err.Error(), want) {
+					t.Errorf("Client.ServicesPush() error = %v, want it to contain %q", err, want)
+				}
+			}
+			if len(tt.wantErrs) < 1 && err != nil {
+				t.Errorf("Client.ServicesPush() error = %v", err)
+			}
+			if diff := cmp.Diff(got, tt.want); diff != "" {
+				t.Errorf("mismatch (-got +want):\n%s", diff)
+			}
+			if tt.wantMax > 0 && stub.maxRun > tt.wantMax {
+				t.Errorf("pushed %v at once, want at most %v", stub.maxRun, tt.wantMax)
+			}
+		})
+	}
+}
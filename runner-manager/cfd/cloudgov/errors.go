@@ -0,0 +1,245 @@
+package cloudgov
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudfoundry/go-cfclient/v3/client"
+	"github.com/cloudfoundry/go-cfclient/v3/resource"
+)
+
+// Kinds of APIError to check for with errors.Is, e.g.,
+//
+//	if errors.Is(err, cloudgov.ErrQuotaExceeded) { ... }
+var (
+	ErrNotFound      = errors.New("not found")
+	ErrUnauthorized  = errors.New("unauthorized")
+	ErrQuotaExceeded = errors.New("quota exceeded")
+	ErrStagingFailed = errors.New("staging failed")
+	ErrNameConflict  = errors.New("name conflict")
+	ErrRateLimited   = errors.New("rate limited")
+	ErrUnavailable   = errors.New("unavailable")
+)
+
+// APIError is a failed CF API call. It matches its Kind with errors.Is,
+// and unwraps to the error from go-cfclient.
+type APIError struct {
+	Kind       error  // one of the Err* kinds above, nil if we don't know
+	StatusCode int    // HTTP status, if we saw it
+	Code       int    // CF error code, e.g., 10010
+	Title      string // CF error title, e.g., "CF-ResourceNotFound"
+	Detail     string // CF's description of what went wrong
+	RequestID  string // X-Vcap-Request-Id, to look the call up in CF's logs
+	RetryAfter time.Duration
+	Err        error
+}
+
+func (e *APIError) Error() string {
+	if e.RequestID == "" {
+		return e.Err.Error()
+	}
+	return fmt.Sprintf("%v (request ID %v)", e.Err, e.RequestID)
+}
+
+func (e *APIError) Unwrap() error {
+	return e.Err
+}
+
+func (e *APIError) Is(target error) bool {
+	return e.Kind != nil && target == e.Kind
+}
+
+// kinds maps go-cfclient's checks for CF error codes to our kinds.
+var kinds = []struct {
+	kind error
+	is   []func(error) bool
+}{
+	{ErrNotFound, []func(error) bool{
+		resource.IsNotFoundError,
+		resource.IsResourceNotFoundError,
+		resource.IsAppNotFoundError,
+		resource.IsAppPackageNotFoundError,
+		resource.IsProcessNotFoundError,
+		resource.IsRouteNotFoundError,
+		resource.IsDomainNotFoundError,
+		resource.IsOrganizationNotFoundError,
+		resource.IsSpaceNotFoundError,
+	}},
+	{ErrUnauthorized, []func(error) bool{
+		resource.IsInvalidAuthTokenError,
+		resource.IsNotAuthenticatedError,
+		resource.IsNotAuthorizedError,
+	}},
+	{ErrQuotaExceeded, []func(error) bool{
+		resource.IsAppMemoryQuotaExceededError,
+		resource.IsQuotaInstanceMemoryLimitExceededError,
+		resource.IsQuotaInstanceLimitExceededError,
+		resource.IsOrgQuotaLogRateLimitExceededError,
+		resource.IsOrgQuotaTotalRoutesExceededError,
+		resource.IsSpaceQuotaMemoryLimitExceededError,
+		resource.IsSpaceQuotaInstanceMemoryLimitExceededError,
+		resource.IsSpaceQuotaInstanceLimitExceededError,
+		resource.IsSpaceQuotaLogRateLimitExceededError,
+		resource.IsSpaceQuotaTotalRoutesExceededError,
+	}},
+	{ErrStagingFailed, []func(error) bool{
+		resource.IsStagingError,
+		resource.IsStagingTimeExpiredError,
+		resource.IsDockerImageMissingError,
+		resource.IsNoAppDetectedError,
+		resource.IsBuildpackCompileFailedError,
+	}},
+	{ErrNameConflict, []func(error) bool{
+		resource.IsAppNameTakenError,
+		resource.IsRouteHostTakenError,
+		resource.IsRoutePathTakenError,
+		resource.IsRouteMappingTakenError,
+	}},
+	{ErrRateLimited, []func(error) bool{
+		resource.IsRateLimitExceededError,
+		resource.IsIPBasedRateLimitExceededError,
+	}},
+	{ErrUnavailable, []func(error) bool{
+		resource.IsServiceUnavailableError,
+		resource.IsBlobstoreUnavailableError,
+		resource.IsStagerUnavailableError,
+		resource.IsRunnerUnavailableError,
+		resource.IsInsufficientResourcesError,
+	}},
+}
+
+// kindOf works out what kind of failure err is, from its CF error code
+// if it has one, else its HTTP status.
+func kindOf(err error, status int) error {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.Kind != nil {
+		return apiErr.Kind
+	}
+
+	for _, k := range kinds {
+		for _, is := range k.is {
+			if is(err) {
+				return k.kind
+			}
+		}
+	}
+
+	// v3 reports most name clashes as a generic 422
+	if resource.IsUnprocessableEntityError(err) {
+		var cfErr resource.CloudFoundryError
+		errors.As(err, &cfErr)
+		detail := strings.ToLower(cfErr.Detail)
+		if strings.Contains(detail, "must be unique") || strings.Contains(detail, "already exists") ||
+			strings.Contains(detail, "taken") {
+			return ErrNameConflict
+		}
+	}
+
+	// Single() calls, e.g., finding an org by name
+	if errors.Is(err, client.ErrExactlyOneResultNotReturned) || errors.Is(err, client.ErrNoResultsReturned) {
+		return ErrNotFound
+	}
+
+	var httpErr resource.CloudFoundryHTTPError
+	if errors.As(err, &httpErr) {
+		status = httpErr.StatusCode
+	}
+	switch status {
+	case http.StatusNotFound:
+		return ErrNotFound
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return ErrUnauthorized
+	case http.StatusTooManyRequests:
+		return ErrRateLimited
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return ErrUnavailable
+	}
+	return nil
+}
+
+// toAPIError makes err from a CF API call an *APIError, adding what we
+// recorded of the failed response. Errors we can't say anything more
+// about, e.g., cancellation, are returned as is.
+func toAPIError(err error, info *responseInfo) error {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return err
+	}
+
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return err
+	}
+
+	e := &APIError{Err: err}
+	if info != nil {
+		e.StatusCode, e.RequestID, e.RetryAfter = info.get()
+	}
+
+	var cfErr resource.CloudFoundryError
+	if errors.As(err, &cfErr) {
+		e.Code, e.Title, e.Detail = cfErr.Code, cfErr.Title, cfErr.Detail
+	}
+	var httpErr resource.CloudFoundryHTTPError
+	if errors.As(err, &httpErr) {
+		e.StatusCode = httpErr.StatusCode
+	}
+
+	e.Kind = kindOf(err, e.StatusCode)
+	if e.Kind == nil && e.StatusCode == 0 && e.Code == 0 {
+		return err
+	}
+	return e
+}
+
+// responseInfo records what go-cfclient's errors leave out of the last
+// failed response to a call, e.g., the request ID.
+type responseInfo struct {
+	mu         sync.Mutex
+	status     int
+	requestID  string
+	retryAfter time.Duration
+}
+
+func (i *responseInfo) get() (status int, requestID string, retryAfter time.Duration) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.status, i.requestID, i.retryAfter
+}
+
+type responseInfoKey struct{}
+
+func withResponseInfo(ctx context.Context) (context.Context, *responseInfo) {
+	info := &responseInfo{}
+	return context.WithValue(ctx, responseInfoKey{}, info), info
+}
+
+// responseInfoTransport fills in the request's responseInfo, if it has
+// one, from failed responses.
+type responseInfoTransport struct {
+	base http.RoundTripper
+}
+
+func newResponseInfoTransport() *responseInfoTransport {
+	return &responseInfoTransport{base: http.DefaultTransport.(*http.Transport).Clone()}
+}
+
+func (t *responseInfoTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	res, err := t.base.RoundTrip(req)
+	if err != nil || res.StatusCode < http.StatusBadRequest {
+		return res, err
+	}
+
+	if info, ok := req.Context().Value(responseInfoKey{}).(*responseInfo); ok {
+		info.mu.Lock()
+		info.status = res.StatusCode
+		info.requestID = res.Header.Get("X-Vcap-Request-Id")
+		info.retryAfter = parseRetryAfter(res.Header.Get("Retry-After"), time.Now())
+		info.mu.Unlock()
+	}
+	return res, nil
+}
@@ -0,0 +1,157 @@
+package cloudgov
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/cloudfoundry/go-cfclient/v3/client"
+	"github.com/cloudfoundry/go-cfclient/v3/resource"
+	"github.com/google/go-cmp/cmp"
+)
+
+func Test_toAPIError(t *testing.T) {
+	nameTaken := resource.NewUnprocessableEntityError()
+	nameTaken.Detail = "Name must be unique per space"
+
+	tests := map[string]struct {
+		err      error
+		info     *responseInfo
+		wantKind error
+		wantCode int
+		wantMsg  string
+	}{
+		"maps not found": {
+			err:      resource.NewResourceNotFoundError(),
+			wantKind: ErrNotFound,
+			wantCode: 10010,
+		},
+		"maps unauthorized": {
+			err:      resource.NewNotAuthorizedError(),
+			wantKind: ErrUnauthorized,
+			wantCode: 10003,
+		},
+		"maps quota exceeded": {
+			err:      resource.NewSpaceQuotaMemoryLimitExceededError(),
+			wantKind: ErrQuotaExceeded,
+			wantCode: 310003,
+		},
+		"maps staging failures": {
+			err:      resource.NewStagingError(),
+			wantKind: ErrStagingFailed,
+			wantCode: 170001,
+		},
+		"maps taken names": {
+			err:      resource.NewAppNameTakenError(),
+			wantKind: ErrNameConflict,
+			wantCode: 100002,
+		},
+		"maps names that must be unique": {
+			err:      nameTaken,
+			wantKind: ErrNameConflict,
+			wantCode: 10008,
+		},
+		"maps rate limiting": {
+			err:      resource.NewRateLimitExceededError(),
+			wantKind: ErrRateLimited,
+			wantCode: 10013,
+		},
+		"maps HTTP statuses": {
+			err:      resource.CloudFoundryHTTPError{StatusCode: http.StatusBadGateway, Status: "502 Bad Gateway"},
+			wantKind: ErrUnavailable,
+		},
+		"maps missing single results": {
+			err:      fmt.Errorf("could not find org bad: %w", client.ErrExactlyOneResultNotReturned),
+			wantKind: ErrNotFound,
+			wantMsg:  "could not find org bad: expected exactly 1 result, but got less or more than 1",
+		},
+		"keeps the request ID": {
+			err:      resource.CloudFoundryError{Code: 10010, Title: "CF-ResourceNotFound", Detail: "App not found"},
+			info:     &responseInfo{status: http.StatusNotFound, requestID: "abc::123"},
+			wantKind: ErrNotFound,
+			wantCode: 10010,
+			wantMsg:  "cfclient error (CF-ResourceNotFound|10010): App not found (request ID abc::123)",
+		},
+		"uses the status for unknown codes": {
+			err:      resource.CloudFoundryError{Code: 99, Title: "CF-Weird"},
+			info:     &responseInfo{status: http.StatusTooManyRequests},
+			wantKind: ErrRateLimited,
+			wantCode: 99,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := toAPIError(tt.err, tt.info)
+
+			var apiErr *APIError
+			if !errors.As(err, &apiErr) {
+				t.Fatalf("toAPIError() = %#v, want an *APIError", err)
+			}
+			if !errors.Is(err, tt.wantKind) {
+				t.Errorf("toAPIError() kind = %v, want %v", apiErr.Kind, tt.wantKind)
+			}
+			// not errors.Is, CloudFoundryHTTPError isn't comparable
+			if apiErr.Err.Error() != tt.err.Error() {
+				t.Errorf("toAPIError() wraps %v, want %v", apiErr.Err, tt.err)
+			}
+			if apiErr.Code != tt.wantCode {
+				t.Errorf("toAPIError() code = %v, want %v", apiErr.Code, tt.wantCode)
+			}
+			if tt.wantMsg != "" && err.Error() != tt.wantMsg {
+				t.Errorf("toAPIError() message = %q, want %q", err.Error(), tt.wantMsg)
+			}
+		})
+	}
+}
+
+func Test_toAPIError_passesThrough(t *testing.T) {
+	apiErr := &APIError{Kind: ErrNotFound, Err: errors.New("gone")}
+
+	tests := map[string]error{
+		"nil":                  nil,
+		"cancellation":         fmt.Errorf("error pushing: %w", context.Canceled),
+		"errors it can't type": errors.New("connection reset"),
+		"APIErrors":            apiErr,
+	}
+
+	for name, err := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := toAPIError(err, &responseInfo{}); got != err {
+				t.Errorf("toAPIError() = %v, want %v", got, err)
+			}
+		})
+	}
+}
+
+func TestResponseInfoTransport(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "7")
+		w.Header().Set("X-Vcap-Request-Id", "abc::123")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	ctx, info := withResponseInfo(context.Background())
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := newResponseInfoTransport().RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	status, requestID, retryAfter := info.get()
+	got := []any{status, requestID, retryAfter}
+	want := []any{http.StatusServiceUnavailable, "abc::123", 7 * time.Second}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("mismatch (-got +want):\n%s", diff)
+	}
+}
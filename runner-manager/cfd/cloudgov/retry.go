@@ -0,0 +1,315 @@
+package cloudgov
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// RetryOpts configures retrying transient CF API failures, e.g., 502s,
+// 503s, rate limiting, or dropped connections. Zero values get defaults.
+type RetryOpts struct {
+	MaxAttempts   int           // including the first try
+	BaseDelay     time.Duration // doubled after each attempt
+	MaxDelay      time.Duration // cap on backoff
+	MaxRetryAfter time.Duration // cap on waits CF asks for with Retry-After
+}
+
+const (
+	retryMaxAttemptsDefault = 4
+	retryBaseDelayDefault   = time.Second
+	retryMaxDelayDefault    = 30 * time.Second
+
+	// CF can ask for longer waits than backoff would, but not so long a
+	// bad header holds a stage up until its deadline
+	retryMaxRetryAfterDefault = 2 * time.Minute
+)
+
+func (o RetryOpts) maxAttempts() int {
+	if o.MaxAttempts < 1 {
+		return retryMaxAttemptsDefault
+	}
+	return o.MaxAttempts
+}
+
+// retryAfter caps a wait CF asked for.
+func (o RetryOpts) retryAfter(d time.Duration) time.Duration {
+	if o.MaxRetryAfter <= 0 {
+		return min(d, retryMaxRetryAfterDefault)
+	}
+	return min(d, o.MaxRetryAfter)
+}
+
+// backoff is an exponential delay for attempt (1 for the first retry),
+// with jitter so concurrent jobs don't retry in lockstep.
+func (o RetryOpts) backoff(attempt int) time.Duration {
+	base, maxDelay := o.BaseDelay, o.MaxDelay
+	if base <= 0 {
+		base = retryBaseDelayDefault
+	}
+	if maxDelay <= 0 {
+		maxDelay = retryMaxDelayDefault
+	}
+
+	d := base
+	for i := 1; i < attempt && d < maxDelay; i++ {
+		d *= 2
+	}
+	d = min(d, maxDelay)
+
+	// somewhere in [d/2, d)
+	return d/2 + rand.N(d/2+1)
+}
+
+// RetryError is returned by retried calls that still failed. Calls that
+// failed on their first attempt return their error as is.
+type RetryError struct {
+	Op       string
+	Attempts int
+	Err      error
+}
+
+func (e *RetryError) Error() string {
+	s := "s"
+	if e.Attempts == 1 {
+		s = ""
+	}
+	return fmt.Sprintf("%v failed after %d attempt%v: %v", e.Op, e.Attempts, s, e.Err)
+}
+
+func (e *RetryError) Unwrap() error {
+	return e.Err
+}
+
+// retryClientAPI decorates a ClientAPI, retrying operations that are
+// safe to repeat. Others, like mapRoute, pass straight through.
+type retryClientAPI struct {
+	ClientAPI
+	opts RetryOpts
+}
+
+func newRetryClientAPI(i ClientAPI, o RetryOpts) *retryClientAPI {
+	return &retryClientAPI{ClientAPI: i, opts: o}
+}
+
+func (r *retryClientAPI) do(ctx context.Context, op string, f func(ctx context.Context) error) error {
+	maxAttempts := r.opts.maxAttempts()
+
+	for attempt := 1; ; attempt++ {
+		err := f(ctx)
+		if err == nil {
+			return nil
+		}
+		if attempt >= maxAttempts || !isTransient(err) || ctx.Err() != nil {
+			return retryError(op, attempt, err)
+		}
+
+		wait := r.opts.backoff(attempt)
+		var apiErr *APIError
+		if errors.As(err, &apiErr) {
+			wait = max(wait, r.opts.retryAfter(apiErr.RetryAfter))
+		}
+
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return retryError(op, attempt, errors.Join(err, ctx.Err()))
+		}
+	}
+}
+
+// retryError wraps err in a RetryError if we made more than one attempt.
+func retryError(op string, attempts int, err error) error {
+	if attempts < 2 {
+		return err
+	}
+	return &RetryError{Op: op, Attempts: attempts, Err: err}
+}
+
+// isTransient reports whether err is worth retrying: the API was busy or
+// unavailable, or the connection failed, as opposed to us asking for
+// something wrong.
+func isTransient(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	if kind := kindOf(err, 0); kind != nil {
+		return kind == ErrRateLimited || kind == ErrUnavailable
+	}
+
+	var netErr net.Error
+	return errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		(errors.As(err, &netErr) && netErr.Timeout())
+}
+
+func (r *retryClientAPI) connect(ctx context.Context, url string, creds *Creds) error {
+	return r.do(ctx, "connect", func(ctx context.Context) error {
+		return r.ClientAPI.connect(ctx, url, creds)
+	})
+}
+
+func (r *retryClientAPI) appGet(ctx context.Context, id string) (app *App, err error) {
+	err = r.do(ctx, "appGet", func(ctx context.Context) (err error) {
+		app, err = r.ClientAPI.appGet(ctx, id)
+		return err
+	})
+	return app, err
+}
+
+func (r *retryClientAPI) appFind(ctx context.Context, orgName string, spaceName string, name string) (app *App, err error) {
+	err = r.do(ctx, "appFind", func(ctx context.Context) (err error) {
+		app, err = r.ClientAPI.appFind(ctx, orgName, spaceName, name)
+		return err
+	})
+	return app, err
+}
+
+func (r *retryClientAPI) appFindInSpace(ctx context.Context, spaceGUID string, name string) (app *App, err error) {
+	err = r.do(ctx, "appFindInSpace", func(ctx context.Context) (err error) {
+		app, err = r.ClientAPI.appFindInSpace(ctx, spaceGUID, name)
+		return err
+	})
+	return app, err
+}
+
+// appPush applies the manifest and stages a new droplet each time, so
+// repeating a push that failed part way through is safe.
+func (r *retryClientAPI) appPush(ctx context.Context, m *AppManifest) (app *App, err error) {
+	err = r.do(ctx, "appPush", func(ctx context.Context) (err error) {
+		app, err = r.ClientAPI.appPush(ctx, m)
+		return err
+	})
+	return app, err
+}
+
+func (r *retryClientAPI) appDelete(ctx context.Context, id string) error {
+	attempts := 0
+	return r.do(ctx, "appDelete", func(ctx context.Context) error {
+		attempts++
+		err := r.ClientAPI.appDelete(ctx, id)
+		// an earlier attempt may have gone through before its response was lost
+		if attempts > 1 && kindOf(err, 0) == ErrNotFound {
+			return nil
+		}
+		return err
+	})
+}
+
+func (r *retryClientAPI) appsList(ctx context.Context) (apps []*App, err error) {
+	err = r.do(ctx, "appsList", func(ctx context.Context) (err error) {
+		apps, err = r.ClientAPI.appsList(ctx)
+		return err
+	})
+	return apps, err
+}
+
+func (r *retryClientAPI) appsListFiltered(ctx context.Context, f *AppsFilter) (apps []*App, err error) {
+	err = r.do(ctx, "appsListFiltered", func(ctx context.Context) (err error) {
+		apps, err = r.ClientAPI.appsListFiltered(ctx, f)
+		return err
+	})
+	return apps, err
+}
+
+func (r *retryClientAPI) appExposedPorts(ctx context.Context, id string) (ports []int, err error) {
+	err = r.do(ctx, "appExposedPorts", func(ctx context.Context) (err error) {
+		ports, err = r.ClientAPI.appExposedPorts(ctx, id)
+		return err
+	})
+	return ports, err
+}
+
+func (r *retryClientAPI) appInstances(ctx context.Context, id string) (instances []*AppInstance, err error) {
+	err = r.do(ctx, "appInstances", func(ctx context.Context) (err error) {
+		instances, err = r.ClientAPI.appInstances(ctx, id)
+		return err
+	})
+	return instances, err
+}
+
+func (r *retryClientAPI) appCrashes(ctx context.Context, id string) (crashes []*AppCrash, err error) {
+	err = r.do(ctx, "appCrashes", func(ctx context.Context) (err error) {
+		crashes, err = r.ClientAPI.appCrashes(ctx, id)
+		return err
+	})
+	return crashes, err
+}
+
+func (r *retryClientAPI) appLogs(ctx context.Context, id string, q logsQuery) (lines []*LogLine, err error) {
+	err = r.do(ctx, "appLogs", func(ctx context.Context) (err error) {
+		lines, err = r.ClientAPI.appLogs(ctx, id, q)
+		return err
+	})
+	return lines, err
+}
+
+func (r *retryClientAPI) spaceFind(ctx context.Context, orgName string, spaceName string) (space *Space, err error) {
+	err = r.do(ctx, "spaceFind", func(ctx context.Context) (err error) {
+		space, err = r.ClientAPI.spaceFind(ctx, orgName, spaceName)
+		return err
+	})
+	return space, err
+}
+
+func (r *retryClientAPI) spaceGet(ctx context.Context, guid string) (space *Space, err error) {
+	err = r.do(ctx, "spaceGet", func(ctx context.Context) (err error) {
+		space, err = r.ClientAPI.spaceGet(ctx, guid)
+		return err
+	})
+	return space, err
+}
+
+func (r *retryClientAPI) sshCode(ctx context.Context) (code string, err error) {
+	err = r.do(ctx, "sshCode", func(ctx context.Context) (err error) {
+		code, err = r.ClientAPI.sshCode(ctx)
+		return err
+	})
+	return code, err
+}
+
+// deleteAppRoutes lists routes fresh each time, so retries pick up
+// only those that are left.
+func (r *retryClientAPI) deleteAppRoutes(ctx context.Context, appGUID string) error {
+	return r.do(ctx, "deleteAppRoutes", func(ctx context.Context) error {
+		return r.ClientAPI.deleteAppRoutes(ctx, appGUID)
+	})
+}
+
+// addNetworkPolicy is idempotent, the policy server ignores policies
+// that already exist.
+func (r *retryClientAPI) addNetworkPolicy(ctx context.Context, fromGUID string, toGUID string, portRanges []string) error {
+	return r.do(ctx, "addNetworkPolicy", func(ctx context.Context) error {
+		return r.ClientAPI.addNetworkPolicy(ctx, fromGUID, toGUID, portRanges)
+	})
+}
+
+func (r *retryClientAPI) removeNetworkPolicies(ctx context.Context, guid string) error {
+	return r.do(ctx, "removeNetworkPolicies", func(ctx context.Context) error {
+		return r.ClientAPI.removeNetworkPolicies(ctx, guid)
+	})
+}
+
+// parseRetryAfter reads a Retry-After header, either delay-seconds or an
+// HTTP date, returning 0 if it's missing or malformed.
+func parseRetryAfter(v string, now time.Time) time.Duration {
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		return max(time.Duration(secs)*time.Second, 0)
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return max(t.Sub(now), 0)
+	}
+	return 0
+}
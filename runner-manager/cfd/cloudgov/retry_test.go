@@ -0,0 +1,232 @@
+package cloudgov
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cloudfoundry/go-cfclient/v3/resource"
+)
+
+// flakyClientAPI fails each call with the next of errs, then succeeds.
+type flakyClientAPI struct {
+	ClientAPI
+	errs  []error
+	calls int
+}
+
+func (a *flakyClientAPI) next() error {
+	a.calls++
+	if len(a.errs) < 1 {
+		return nil
+	}
+	err := a.errs[0]
+	a.errs = a.errs[1:]
+	return err
+}
+
+func (a *flakyClientAPI) appsList(ctx context.Context) ([]*App, error) {
+	if err := a.next(); err != nil {
+		return nil, err
+	}
+	return []*App{{Name: "foo"}}, nil
+}
+
+func (a *flakyClientAPI) appDelete(ctx context.Context, id string) error {
+	return a.next()
+}
+
+func (a *flakyClientAPI) mapRoute(ctx context.Context, app *App, domain string, space string, host string, path string, port int) error {
+	return a.next()
+}
+
+var (
+	errUnavailable = resource.CloudFoundryHTTPError{StatusCode: http.StatusServiceUnavailable}
+	errBadGateway  = resource.CloudFoundryHTTPError{StatusCode: http.StatusBadGateway}
+	errBadRequest  = resource.CloudFoundryHTTPError{StatusCode: http.StatusBadRequest}
+)
+
+func TestRetryClientAPI(t *testing.T) {
+	fast := RetryOpts{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond}
+
+	tests := map[string]struct {
+		errs      []error
+		call      func(r *retryClientAPI) error
+		wantCalls int
+		wantErr   string
+	}{
+		"succeeds without retrying": {
+			call:      func(r *retryClientAPI) error { _, err := r.appsList(context.Background()); return err },
+			wantCalls: 1,
+		},
+		"retries transient failures": {
+			errs:      []error{errUnavailable, errBadGateway},
+			call:      func(r *retryClientAPI) error { _, err := r.appsList(context.Background()); return err },
+			wantCalls: 3,
+		},
+		"gives up after max attempts": {
+			errs:      []error{errUnavailable, errUnavailable, errUnavailable},
+			call:      func(r *retryClientAPI) error { _, err := r.appsList(context.Background()); return err },
+			wantCalls: 3,
+			wantErr:   "appsList failed after 3 attempts",
+		},
+		"doesn't retry other failures": {
+			errs:      []error{errBadRequest},
+			call:      func(r *retryClientAPI) error { _, err := r.appsList(context.Background()); return err },
+			wantCalls: 1,
+			wantErr:   errBadRequest.Error(),
+		},
+		"retries rate limiting": {
+			errs:      []error{resource.NewRateLimitExceededError()},
+			call:      func(r *retryClientAPI) error { _, err := r.appsList(context.Background()); return err },
+			wantCalls: 2,
+		},
+		"treats a retried delete that's already gone as done": {
+			errs:      []error{errBadGateway, resource.NewResourceNotFoundError()},
+			call:      func(r *retryClientAPI) error { return r.appDelete(context.Background(), "guid") },
+			wantCalls: 2,
+		},
+		"reports a first delete that's not found": {
+			errs:      []error{resource.NewResourceNotFoundError()},
+			call:      func(r *retryClientAPI) error { return r.appDelete(context.Background(), "guid") },
+			wantCalls: 1,
+			wantErr:   resource.NewResourceNotFoundError().Error(),
+		},
+		"doesn't retry mapping routes": {
+			errs: []error{errUnavailable},
+			call: func(r *retryClientAPI) error {
+				return r.mapRoute(context.Background(), &App{}, "", "", "", "", 0)
+			},
+			wantCalls: 1,
+			wantErr:   errUnavailable.Error(),
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			stub := &flakyClientAPI{errs: tt.errs}
+			r := newRetryClientAPI(stub, fast)
+
+			err := tt.call(r)
+			if (err != nil) != (tt.wantErr != "") {
+				t.Fatalf("error = %v, wantErr %q", err, tt.wantErr)
+			}
+			if err != nil && !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %v, want it to contain %q", err, tt.wantErr)
+			}
+			var retryErr *RetryError
+			if errors.As(err, &retryErr) && retryErr.Attempts < 2 {
+				t.Errorf("error = %v, want a RetryError only after retrying", err)
+			}
+			if stub.calls != tt.wantCalls {
+				t.Errorf("made %v calls, want %v", stub.calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestRetryClientAPI_stopsWhenCancelled(t *testing.T) {
+	stub := &flakyClientAPI{errs: []error{errUnavailable, errUnavailable}}
+	r := newRetryClientAPI(stub, RetryOpts{BaseDelay: time.Hour, MaxDelay: time.Hour})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	_, err := r.appsList(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("error = %v, want it to wrap %v", err, context.DeadlineExceeded)
+	}
+
+	var retryErr *RetryError
+	if errors.As(err, &retryErr) {
+		t.Errorf("error = %v, want no RetryError after 1 attempt", err)
+	}
+}
+
+func TestRetryClientAPI_capsRetryAfter(t *testing.T) {
+	rateLimited := &APIError{Kind: ErrRateLimited, RetryAfter: 24 * time.Hour, Err: errors.New("slow down")}
+	stub := &flakyClientAPI{errs: []error{rateLimited}}
+	r := newRetryClientAPI(stub, RetryOpts{
+		BaseDelay:     time.Millisecond,
+		MaxDelay:      time.Millisecond,
+		MaxRetryAfter: time.Millisecond,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := r.appsList(ctx); err != nil {
+		t.Fatalf("error = %v, want a retry after at most MaxRetryAfter", err)
+	}
+	if stub.calls != 2 {
+		t.Errorf("made %v calls, want 2", stub.calls)
+	}
+}
+
+func TestRetryOpts_retryAfter(t *testing.T) {
+	tests := map[string]struct {
+		opts RetryOpts
+		d    time.Duration
+		want time.Duration
+	}{
+		"keeps short waits":     {d: 10 * time.Second, want: 10 * time.Second},
+		"caps long waits":       {d: 24 * time.Hour, want: retryMaxRetryAfterDefault},
+		"caps at MaxRetryAfter": {opts: RetryOpts{MaxRetryAfter: time.Minute}, d: time.Hour, want: time.Minute},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := tt.opts.retryAfter(tt.d); got != tt.want {
+				t.Errorf("retryAfter(%v) = %v, want %v", tt.d, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryOpts_backoff(t *testing.T) {
+	o := RetryOpts{BaseDelay: time.Second, MaxDelay: 10 * time.Second}
+
+	// attempt: the most we should wait
+	tests := map[int]time.Duration{
+		1:  time.Second,
+		2:  2 * time.Second,
+		3:  4 * time.Second,
+		5:  10 * time.Second,
+		50: 10 * time.Second,
+	}
+	for attempt, ceil := range tests {
+		for range 20 {
+			got := o.backoff(attempt)
+			if got < ceil/2 || got > ceil {
+				t.Errorf("backoff(%v) = %v, want within [%v, %v]", attempt, got, ceil/2, ceil)
+			}
+		}
+	}
+}
+
+func Test_parseRetryAfter(t *testing.T) {
+	now := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	tests := map[string]struct {
+		val  string
+		want time.Duration
+	}{
+		"is zero when unset":     {},
+		"parses seconds":         {val: "120", want: 2 * time.Minute},
+		"parses an HTTP date":    {val: "Thu, 02 Jan 2025 03:04:35 GMT", want: 30 * time.Second},
+		"is zero for past dates": {val: "Thu, 02 Jan 2025 03:00:00 GMT"},
+		"is zero for garbage":    {val: "later"},
+		"is zero for negatives":  {val: "-5"},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := parseRetryAfter(tt.val, now); got != tt.want {
+				t.Errorf("parseRetryAfter() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package cloudgov
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// Space is a CF space along with its org.
+type Space struct {
+	GUID    string
+	Name    string
+	OrgGUID string
+	OrgName string
+}
+
+// SpaceAccessError is a space, or its org, that CF says isn't there. CF
+// says the same of ones the service account has no role in, so that's
+// the likely cause if it does exist.
+type SpaceAccessError struct {
+	Org   string // name, "" if we looked the space up by GUID
+	Space string // name, or GUID
+	Err   error
+}
+
+func (e *SpaceAccessError) Error() string {
+	space := fmt.Sprintf("space %v", e.Space)
+	if e.Org != "" {
+		space = fmt.Sprintf("space %v in org %v", e.Space, e.Org)
+	}
+	return fmt.Sprintf(
+		"could not find %v, check it exists and the service account has a role in it: %v", space, e.Err,
+	)
+}
+
+func (e *SpaceAccessError) Unwrap() error {
+	return e.Err
+}
+
+// SpaceFind resolves org and space names to the space's and org's GUIDs.
+// The client caches lookups, by name and GUID, for as long as it lives.
+func (c *Client) SpaceFind(ctx context.Context, orgName string, spaceName string) (*Space, error) {
+	if orgName == "" || spaceName == "" {
+		return nil, CloudGovClientError{"SpaceFind: org and space names must be defined"}
+	}
+	if space := c.spaces.get(orgName, spaceName); space != nil {
+		return space, nil
+	}
+
+	space, err := c.spaceFind(ctx, orgName, spaceName)
+	if err != nil {
+		return nil, err
+	}
+	c.spaces.add(space)
+	return space, nil
+}
+
+// SpaceGet resolves a space's GUID to its and its org's names. As with
+// SpaceFind, the client caches lookups.
+func (c *Client) SpaceGet(ctx context.Context, guid string) (*Space, error) {
+	if guid == "" {
+		return nil, CloudGovClientError{"SpaceGet: space GUID must be defined"}
+	}
+	if space := c.spaces.getGUID(guid); space != nil {
+		return space, nil
+	}
+
+	space, err := c.spaceGet(ctx, guid)
+	if err != nil {
+		return nil, err
+	}
+	c.spaces.add(space)
+	return space, nil
+}
+
+// spaceCache holds the spaces we've resolved, by GUID and by name. Its
+// zero value is empty and ready to use.
+type spaceCache struct {
+	mu     sync.Mutex
+	byGUID map[string]*Space
+	byName map[[2]string]*Space // {org, space}
+}
+
+func (sc *spaceCache) get(orgName string, spaceName string) *Space {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	return sc.byName[[2]string{orgName, spaceName}]
+}
+
+func (sc *spaceCache) getGUID(guid string) *Space {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	return sc.byGUID[guid]
+}
+
+func (sc *spaceCache) add(s *Space) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	if sc.byGUID == nil {
+		sc.byGUID = map[string]*Space{}
+		sc.byName = map[[2]string]*Space{}
+	}
+	sc.byGUID[s.GUID] = s
+	sc.byName[[2]string{s.OrgName, s.Name}] = s
+}
@@ -0,0 +1,142 @@
+package cloudgov
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestCFClientAPI_spaces(t *testing.T) {
+	connect := func(t *testing.T) (*fakeCF, *CFClientAPI) {
+		cf := newFakeCF(t)
+		api := &CFClientAPI{}
+		if err := api.connect(context.Background(), cf.URL, &Creds{Username: "u", Password: "p"}); err != nil {
+			t.Fatal(err)
+		}
+		return cf, api
+	}
+
+	tests := map[string]struct {
+		find    func(api *CFClientAPI) error
+		wantMsg string
+	}{
+		"missing orgs": {
+			find: func(api *CFClientAPI) error {
+				_, err := api.spaceFind(context.Background(), "nope", "space")
+				return err
+			},
+			wantMsg: "could not find space space in org nope, check it exists and the service account has a role in it",
+		},
+		"missing spaces": {
+			find: func(api *CFClientAPI) error {
+				_, err := api.spaceFind(context.Background(), "org", "nope")
+				return err
+			},
+			wantMsg: "could not find space nope in org org, check it exists",
+		},
+		"missing GUIDs": {
+			find: func(api *CFClientAPI) error {
+				_, err := api.spaceGet(context.Background(), "nope")
+				return err
+			},
+			wantMsg: "could not find space nope, check it exists",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run("explains "+name, func(t *testing.T) {
+			_, api := connect(t)
+
+			err := tt.find(api)
+			var accessErr *SpaceAccessError
+			if !errors.As(err, &accessErr) {
+				t.Fatalf("error = %v, want a SpaceAccessError", err)
+			}
+			if !errors.Is(err, ErrNotFound) {
+				t.Errorf("error = %v, want it to be ErrNotFound", err)
+			}
+			if !strings.Contains(err.Error(), tt.wantMsg) {
+				t.Errorf("error = %v, want it to contain %q", err, tt.wantMsg)
+			}
+		})
+	}
+}
+
+func TestClient_spaces(t *testing.T) {
+	want := &Space{GUID: "space-guid", Name: "space", OrgGUID: "org-guid", OrgName: "org"}
+
+	connect := func(t *testing.T) (*fakeCF, *Client) {
+		cf := newFakeCF(t)
+		api := &CFClientAPI{}
+		if err := api.connect(context.Background(), cf.URL, &Creds{Username: "u", Password: "p"}); err != nil {
+			t.Fatal(err)
+		}
+		return cf, &Client{ClientAPI: api}
+	}
+
+	t.Run("resolves names once", func(t *testing.T) {
+		cf, c := connect(t)
+
+		for range 2 {
+			got, err := c.SpaceFind(context.Background(), "org", "space")
+			if err != nil {
+				t.Fatalf("Client.SpaceFind() error = %v", err)
+			}
+			if diff := cmp.Diff(got, want); diff != "" {
+				t.Errorf("mismatch (-got +want):\n%s", diff)
+			}
+		}
+
+		// and knows the GUID from then on
+		if _, err := c.SpaceGet(context.Background(), "space-guid"); err != nil {
+			t.Fatalf("Client.SpaceGet() error = %v", err)
+		}
+
+		wantReads := map[string]int{"/v3/organizations": 1, "/v3/spaces": 1}
+		if diff := cmp.Diff(cf.cfReads, wantReads); diff != "" {
+			t.Errorf("lookups mismatch (-got +want):\n%s", diff)
+		}
+	})
+
+	t.Run("resolves GUIDs once", func(t *testing.T) {
+		cf, c := connect(t)
+
+		for range 2 {
+			got, err := c.SpaceGet(context.Background(), "space-guid")
+			if err != nil {
+				t.Fatalf("Client.SpaceGet() error = %v", err)
+			}
+			if diff := cmp.Diff(got, want); diff != "" {
+				t.Errorf("mismatch (-got +want):\n%s", diff)
+			}
+		}
+		if _, err := c.SpaceFind(context.Background(), "org", "space"); err != nil {
+			t.Fatalf("Client.SpaceFind() error = %v", err)
+		}
+
+		wantReads := map[string]int{"/v3/spaces/space-guid": 1}
+		if diff := cmp.Diff(cf.cfReads, wantReads); diff != "" {
+			t.Errorf("lookups mismatch (-got +want):\n%s", diff)
+		}
+	})
+}
+
+func TestClient_SpaceFind(t *testing.T) {
+	// the stub would panic if we called through without names
+	c := &Client{ClientAPI: &stubClientAPI{}}
+
+	for _, args := range [][2]string{{"", "space"}, {"org", ""}} {
+		_, err := c.SpaceFind(context.Background(), args[0], args[1])
+		var clientErr CloudGovClientError
+		if !errors.As(err, &clientErr) {
+			t.Errorf("Client.SpaceFind(%q, %q) error = %v, want a CloudGovClientError", args[0], args[1], err)
+		}
+	}
+
+	if _, err := c.SpaceGet(context.Background(), ""); err == nil {
+		t.Error("Client.SpaceGet() succeeded without a GUID")
+	}
+}
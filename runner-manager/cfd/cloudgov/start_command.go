@@ -0,0 +1,42 @@
+package cloudgov
+
+import (
+	"regexp"
+	"strings"
+)
+
+// StartCommand makes a CF start command, which CF runs with `sh -c`, from
+// an image's exec-form entrypoint and command, quoting each argument so
+// it reaches the process as is.
+//
+// Like docker, the command follows the entrypoint as its arguments, and
+// an entrypoint of [""] is none at all. A start command replaces the
+// image's ENTRYPOINT, so for a command alone use AppManifestProcess.Args,
+// which we pass to the image's own entrypoint once staging finds it. With
+// neither we return "" and the image's own start applies.
+func StartCommand(entrypoint []string, command []string) string {
+	if len(entrypoint) == 1 && entrypoint[0] == "" {
+		entrypoint = nil
+	}
+
+	args := append(append([]string{}, entrypoint...), command...)
+	if len(args) < 1 {
+		return ""
+	}
+
+	quoted := make([]string, len(args))
+	for i, a := range args {
+		quoted[i] = shellQuote(a)
+	}
+	return strings.Join(quoted, " ")
+}
+
+var shellSafeRegex = regexp.MustCompile(`^[a-zA-Z0-9_@%+=:,./-]+$`)
+
+// shellQuote quotes s for a POSIX shell, leaving it bare if it's safe.
+func shellQuote(s string) string {
+	if shellSafeRegex.MatchString(s) {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
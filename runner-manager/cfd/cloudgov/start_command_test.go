@@ -0,0 +1,90 @@
+package cloudgov
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestStartCommand(t *testing.T) {
+	tests := map[string]struct {
+		entrypoint []string
+		command    []string
+		want       string
+	}{
+		"is empty with neither": {},
+		"uses the entrypoint alone": {
+			entrypoint: []string{"/docker-entrypoint.sh"},
+			want:       "/docker-entrypoint.sh",
+		},
+		"uses the command alone": {
+			command: []string{"postgres", "-c", "fsync=off"},
+			want:    "postgres -c fsync=off",
+		},
+		"passes the command to the entrypoint": {
+			entrypoint: []string{"docker-entrypoint.sh"},
+			command:    []string{"postgres"},
+			want:       "docker-entrypoint.sh postgres",
+		},
+		"resets the entrypoint with an empty string": {
+			entrypoint: []string{""},
+			command:    []string{"redis-server"},
+			want:       "redis-server",
+		},
+		"is empty with only a reset entrypoint": {
+			entrypoint: []string{""},
+		},
+		"keeps shell scripts together": {
+			command: []string{"sh", "-c", "echo hi && sleep 5"},
+			want:    `sh -c 'echo hi && sleep 5'`,
+		},
+		"escapes single quotes": {
+			command: []string{"echo", "it's"},
+			want:    `echo 'it'\''s'`,
+		},
+		"doesn't expand variables": {
+			command: []string{"echo", "$HOME", "${PATH}", "`id`", "$(id)"},
+			want:    `echo '$HOME' '${PATH}' '` + "`id`" + `' '$(id)'`,
+		},
+		"keeps empty arguments": {
+			command: []string{"run", "", "--flag="},
+			want:    `run '' --flag=`,
+		},
+		"keeps surrounding whitespace": {
+			command: []string{" padded ", "tab\there", "new\nline"},
+			want:    "' padded ' 'tab\there' 'new\nline'",
+		},
+		"quotes globs and redirects": {
+			command: []string{"ls", "*.txt", ">", "out", "a;b", "a|b", "~"},
+			want:    `ls '*.txt' '>' out 'a;b' 'a|b' '~'`,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := StartCommand(tt.entrypoint, tt.command); got != tt.want {
+				t.Errorf("StartCommand() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestStartCommand_sh checks the arguments survive CF's `sh -c` intact.
+func TestStartCommand_sh(t *testing.T) {
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("no sh to run commands with")
+	}
+
+	args := []string{"plain", "", " spaced ", "it's", `"double"`, "$HOME", "`id`", "a;b", "*", "new\nline", `back\slash`}
+	cmd := StartCommand([]string{"printf", "[%s]"}, args)
+
+	out, err := exec.Command(sh, "-c", cmd).Output()
+	if err != nil {
+		t.Fatalf("error running %q: %v", cmd, err)
+	}
+	want := "[" + strings.Join(args, "][") + "]"
+	if string(out) != want {
+		t.Errorf("sh -c %q printed %q, want %q", cmd, out, want)
+	}
+}
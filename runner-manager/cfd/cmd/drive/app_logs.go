@@ -0,0 +1,108 @@
+package drive
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/GSA-TTS/gitlab-runner-cloudgov/runner-manager/cfd/cloudgov"
+)
+
+const (
+	// How much of an app's logs we print when it fails to start
+	failureLogsLimit = 200
+
+	// How long we give log cache after a failure, as the stage's own
+	// deadline may be what failed
+	failureLogsTimeout = 30 * time.Second
+)
+
+func printLogLine(alias string, l *cloudgov.LogLine) {
+	fmt.Printf("[%v] %v\n", alias, l)
+}
+
+// printFailureLogs prints the staging and startup logs of the app for
+// m, prefixed with alias, to show why it didn't start. If the push
+// failed we look the app up, and it may not exist. We're failing
+// anyway, so not getting logs is just a warning.
+func (s *commonStage) printFailureLogs(
+	ctx context.Context, alias string, m *cloudgov.AppManifest, app *cloudgov.App,
+) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), failureLogsTimeout)
+	defer cancel()
+
+	if app == nil {
+		spaceGUID, err := s.workerSpaceGUID(ctx)
+		if err != nil {
+			fmt.Printf("[cfd] Warning: couldn't get logs for %v: %v\n", alias, err)
+			return
+		}
+		app, err = s.client.AppFindInSpace(ctx, spaceGUID, m.Name)
+		if errors.Is(err, cloudgov.ErrNotFound) {
+			return // the push never got as far as making it
+		}
+		if err != nil {
+			fmt.Printf("[cfd] Warning: couldn't get logs for %v: %v\n", alias, err)
+			return
+		}
+	}
+
+	lines, err := s.client.RecentLogs(ctx, app, failureLogsLimit)
+	if err != nil {
+		fmt.Printf("[cfd] Warning: couldn't get logs for %v: %v\n", alias, err)
+		return
+	}
+
+	fmt.Printf("[cfd] Recent logs for %v:\n", alias)
+	for _, l := range lines {
+		printLogLine(alias, l)
+	}
+}
+
+// streamServiceLogs prints the job's services' logs from since on as
+// they come in, if the job set STREAM_SERVICE_LOGS, until stop is
+// called. Services we haven't pushed are looked up.
+func (s *commonStage) streamServiceLogs(ctx context.Context, since time.Time) (stop func()) {
+	if s.config.StreamServiceLogs != "true" || len(s.config.Services) < 1 {
+		return func() {}
+	}
+
+	spaceGUID, err := s.workerSpaceGUID(ctx)
+	if err != nil {
+		fmt.Printf("[cfd] Warning: couldn't stream service logs: %v\n", err)
+		return func() {}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+
+	for _, serv := range s.config.Services {
+		app := serv.App
+		if app == nil {
+			m := serv.Manifest
+			var err error
+			if app, err = s.client.AppFindInSpace(ctx, spaceGUID, m.Name); err != nil {
+				fmt.Printf("[cfd] Warning: couldn't stream logs for service %v: %v\n", serv.Alias, err)
+				continue
+			}
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := s.client.StreamLogs(ctx, app, since, func(l *cloudgov.LogLine) {
+				printLogLine(serv.Alias, l)
+			})
+			if err != nil {
+				fmt.Printf("[cfd] Warning: stopped streaming logs for service %v: %v\n", serv.Alias, err)
+			}
+		}()
+	}
+
+	return func() {
+		cancel()
+		wg.Wait()
+	}
+}
@@ -0,0 +1,123 @@
+package drive
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GSA-TTS/gitlab-runner-cloudgov/runner-manager/cfd/cloudgov"
+)
+
+// captureStdout returns what f prints.
+func captureStdout(t *testing.T, f func()) string {
+	t.Helper()
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	done := make(chan []byte)
+	go func() {
+		out, _ := io.ReadAll(r)
+		done <- out
+	}()
+
+	f()
+	w.Close()
+	return string(<-done)
+}
+
+// logsCF serves one app, app-guid in space-guid, and its logs.
+func logsCF(t *testing.T, logs string) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch route := r.Method + " " + r.URL.Path; route {
+		case "GET /":
+			url := "http://" + r.Host
+			fmt.Fprintf(w, `{"links":{"login":{"href":%q},"uaa":{"href":%q},"log_cache":{"href":%q}}}`, url, url, url)
+		case "POST /oauth/token":
+			fmt.Fprint(w, `{"access_token":"token","token_type":"bearer","expires_in":3600}`)
+		case "GET /v3/apps":
+			if q := r.URL.Query(); q.Get("space_guids") != "space-guid" || q.Get("names") != "glrw-p-c-j" {
+				t.Errorf("looked for apps with %v, want glrw-p-c-j in space-guid", q)
+			}
+			fmt.Fprint(w, `{"pagination":{"total_results":1,"total_pages":1},"resources":[`+
+				`{"guid":"app-guid","name":"glrw-p-c-j","relationships":{"space":{"data":{"guid":"space-guid"}}}}]}`)
+		case "GET /api/v1/read/app-guid":
+			fmt.Fprint(w, logs)
+		default:
+			t.Errorf("unexpected request %v", route)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestCommonStage_printFailureLogs(t *testing.T) {
+	payload := base64.StdEncoding.EncodeToString([]byte("FATAL: out of memory"))
+	cf := logsCF(t, fmt.Sprintf(`{"envelopes":{"batch":[
+		{"timestamp":"1700000000000000000","source_id":"app-guid","instance_id":"0",
+		 "tags":{"source_type":"APP/PROC/WEB"},"log":{"payload":%q,"type":"ERR"}}
+	]}}`, payload))
+
+	client, err := cloudgov.New(context.Background(), &cloudgov.CFClientAPI{}, &cloudgov.Opts{
+		Creds:      &cloudgov.Creds{Username: "u", Password: "p"},
+		APIRootURL: cf.URL,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &JobConfig{
+		VcapAppData: VcapAppData{OrgName: "org", SpaceName: "space", SpaceID: "space-guid"},
+		WorkerOrg:   "org",
+		WorkerSpace: "space",
+	}
+	s := &commonStage{client: client, config: cfg}
+	m := &cloudgov.AppManifest{Name: "glrw-p-c-j"}
+
+	// the push failed, so we look the app up first
+	out := captureStdout(t, func() {
+		s.printFailureLogs(context.Background(), "worker", m, nil)
+	})
+
+	for _, want := range []string{
+		"[cfd] Recent logs for worker:\n",
+		"[worker] ",
+		"[APP/PROC/WEB/0] ERR FATAL: out of memory\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("printFailureLogs() printed %q, want it to contain %q", out, want)
+		}
+	}
+}
+
+func TestCommonStage_streamServiceLogs_off(t *testing.T) {
+	services := []*Service{{Image: Image{Alias: "db"}}}
+
+	tests := map[string]*JobConfig{
+		"without STREAM_SERVICE_LOGS": {JobResponse: JobResponse{Services: services}},
+		"without services":            {StreamServiceLogs: "true"},
+	}
+
+	for name, cfg := range tests {
+		t.Run(name, func(t *testing.T) {
+			// no client, so this panics if it tries to stream
+			s := &commonStage{config: cfg}
+			stop := s.streamServiceLogs(context.Background(), time.Now())
+			stop()
+		})
+	}
+}
@@ -0,0 +1,140 @@
+package drive
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+const (
+	bundleDirDefault = "/home/vcap/app/cf-driver/worker-setup/bundle"
+	caCertsDir       = "/etc/ssl/certs"
+	certsBundleName  = "certs.tgz"
+	certsLockName    = "certs.lock"
+)
+
+// bundleDir is the worker-setup bundle we copy to each worker.
+func (cfg *JobConfig) bundleDir() string {
+	if cfg.WorkerBundleDir == "" {
+		return bundleDirDefault
+	}
+	return cfg.WorkerBundleDir
+}
+
+// ensureCertsBundle tars up the manager's CA certs into the worker-setup
+// bundle unless that's already been done. Concurrent jobs share a lock
+// next to the bundle so only one of them builds it.
+func ensureCertsBundle(bundleDir string, certsDir string) (err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("error bundling certs: %w", err)
+		}
+	}()
+
+	dst := filepath.Join(bundleDir, certsBundleName)
+	if _, err = os.Stat(dst); err == nil {
+		return nil
+	}
+
+	lockPath := filepath.Join(filepath.Dir(bundleDir), certsLockName)
+	lock, err := os.OpenFile(lockPath, os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return err
+	}
+	defer lock.Close()
+
+	// flock is released when we close the file or exit, so a job that
+	// dies mid-bundle can't leave the rest waiting on a stale lock.
+	if err = syscall.Flock(int(lock.Fd()), syscall.LOCK_EX); err != nil {
+		return err
+	}
+	defer syscall.Flock(int(lock.Fd()), syscall.LOCK_UN)
+
+	// someone else may have made it while we waited
+	if _, err = os.Stat(dst); err == nil {
+		return nil
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	fmt.Println("[cfd] Attempting to create cert bundle")
+
+	// outside the bundle so a partial tarball never gets copied to a worker
+	tmp, err := os.CreateTemp(filepath.Dir(bundleDir), certsBundleName+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err = writeCertsTgz(tmp, certsDir); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), dst)
+}
+
+// writeCertsTgz writes the files in certsDir to w as a gzipped tarball,
+// dereferencing links like `cp -rL` did in the shell driver.
+func writeCertsTgz(w io.Writer, certsDir string) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+
+	entries, err := os.ReadDir(certsDir)
+	if err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		path := filepath.Join(certsDir, e.Name())
+
+		info, err := os.Stat(path)
+		if err != nil {
+			// dangling links are common enough in cert dirs, skip them
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			continue
+		}
+
+		hdr, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		hdr.Name = e.Name()
+
+		if err = tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if err = copyFile(tw, path); err != nil {
+			return err
+		}
+	}
+
+	if err = tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+func copyFile(w io.Writer, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = io.Copy(w, f)
+	return err
+}
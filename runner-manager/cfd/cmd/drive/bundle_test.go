@@ -0,0 +1,98 @@
+package drive
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func Test_ensureCertsBundle(t *testing.T) {
+	dir := t.TempDir()
+	bundleDir := filepath.Join(dir, "bundle")
+	certsDir := filepath.Join(dir, "certs")
+
+	for _, d := range []string{bundleDir, certsDir} {
+		if err := os.Mkdir(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(certsDir, "ca.pem"), []byte("cert"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("ca.pem", filepath.Join(certsDir, "abcd1234.0")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("missing.pem", filepath.Join(certsDir, "dangling.0")); err != nil {
+		t.Fatal(err)
+	}
+
+	// concurrent jobs should all succeed and agree on one bundle
+	var wg sync.WaitGroup
+	errs := make([]error, 4)
+	for i := range errs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = ensureCertsBundle(bundleDir, certsDir)
+		}()
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	f, err := os.Open(filepath.Join(bundleDir, certsBundleName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := map[string]string{}
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got[hdr.Name] = string(b)
+	}
+
+	want := map[string]string{"ca.pem": "cert", "abcd1234.0": "cert"}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("mismatch (-got +want):\n%s", diff)
+	}
+
+	entries, err := os.ReadDir(bundleDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	if !slices.Equal(names, []string{certsBundleName}) {
+		t.Errorf("bundle should only have %v, got %v", certsBundleName, names)
+	}
+}
@@ -1,7 +1,9 @@
 package drive
 
 import (
-	"log"
+	"context"
+	"errors"
+	"fmt"
 
 	"github.com/spf13/cobra"
 )
@@ -31,7 +33,63 @@ DEBUG level. The STDERR will be printed to the logs at a WARN level.
 
 Read more in GitLab's documentation:
 https://docs.gitlab.com/runner/executors/custom.html#cleanup`,
-	Run: func(cmd *cobra.Command, args []string) {
-		log.Println("cleaning up...")
-	},
+	RunE: cleanup,
+}
+
+type cleanupStage commonStage
+
+func cleanup(cmd *cobra.Command, args []string) error {
+	s, err := newStageWith(cmd.Context(), nil, getCleanupConfig)
+	if err != nil {
+		return &SystemFailureError{fmt.Errorf("error initializing cleanup stage: %w", err)}
+	}
+
+	ctx, cancel, err := stageContext(
+		cmd.Context(), "CLEANUP_TIMEOUT", s.common.config.CleanupTimeout, cleanupTimeoutDefault,
+	)
+	if err != nil {
+		return &SystemFailureError{fmt.Errorf("error initializing cleanup stage: %w", err)}
+	}
+	defer cancel()
+
+	err = s.clean.exec(ctx)
+	if err != nil {
+		return &SystemFailureError{fmt.Errorf("error executing cleanup stage: %w", err)}
+	}
+
+	return nil
+}
+
+// exec deletes the job's apps along with their routes and network
+// policies, carrying on past failures so one stuck app doesn't leak the rest.
+func (s *cleanupStage) exec(ctx context.Context) error {
+	common := (*commonStage)(s)
+
+	byName, err := common.jobApps(ctx)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+
+	if s.config.PreserveServices != "true" {
+		for _, serv := range s.config.Services {
+			name := serv.Manifest.Name
+			fmt.Printf("[cfd] Deleting service %v\n", serv.Alias)
+			errs = append(errs, common.deleteApp(ctx, name, byName[name]))
+		}
+	}
+
+	if s.config.PreserveWorker != "true" {
+		name := s.config.ContainerID
+		fmt.Printf("[cfd] Deleting executor instance %v\n", name)
+		errs = append(errs, common.deleteApp(ctx, name, byName[name]))
+	}
+
+	if err = errors.Join(errs...); err != nil {
+		return err
+	}
+
+	fmt.Printf("[cfd] Cleanup completed for %v\n", s.config.ContainerID)
+	return nil
 }
@@ -0,0 +1,160 @@
+package drive
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/GSA-TTS/gitlab-runner-cloudgov/runner-manager/cfd/cloudgov"
+	"github.com/google/go-cmp/cmp"
+)
+
+// testClient connects a client to a fake CF that logs it in and passes
+// every other request to serve.
+func testClient(t *testing.T, serve http.HandlerFunc) *cloudgov.Client {
+	t.Helper()
+
+	cf := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.Method + " " + r.URL.Path {
+		case "GET /":
+			url := "http://" + r.Host
+			fmt.Fprintf(w, `{"links":{"login":{"href":%q},"uaa":{"href":%q}}}`, url, url)
+		case "POST /oauth/token":
+			fmt.Fprint(w, `{"access_token":"token","token_type":"bearer","expires_in":3600}`)
+		default:
+			serve(w, r)
+		}
+	}))
+	t.Cleanup(cf.Close)
+
+	client, err := cloudgov.New(context.Background(), &cloudgov.CFClientAPI{}, &cloudgov.Opts{
+		Creds:      &cloudgov.Creds{Username: "u", Password: "p"},
+		APIRootURL: cf.URL,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func TestCleanupStage_exec(t *testing.T) {
+	const (
+		worker  = "glrw-p-c-j"
+		service = "glrw-p-c-j-svc-db"
+	)
+
+	tests := map[string]struct {
+		cfg         JobConfig
+		missing     []string // apps that aren't there to delete
+		failing     []string // apps CF won't delete
+		wantDeletes []string
+		wantErr     []string
+	}{
+		"deletes the worker and services": {
+			wantDeletes: []string{service, worker},
+		},
+		"keeps services with PRESERVE_SERVICES": {
+			cfg:         JobConfig{PreserveServices: "true"},
+			wantDeletes: []string{worker},
+		},
+		"keeps the worker with PRESERVE_WORKER": {
+			cfg:         JobConfig{PreserveWorker: "true"},
+			wantDeletes: []string{service},
+		},
+		"keeps everything with both": {
+			cfg: JobConfig{PreserveServices: "true", PreserveWorker: "true"},
+		},
+		"skips apps that are already gone": {
+			missing:     []string{service},
+			wantDeletes: []string{worker},
+		},
+		"carries on past failures": {
+			failing:     []string{service},
+			wantDeletes: []string{worker},
+			wantErr:     []string{"error deleting " + service},
+		},
+		"joins every failure": {
+			failing: []string{service, worker},
+			wantErr: []string{"error deleting " + service, "error deleting " + worker},
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			var mu sync.Mutex
+			var deleted []string
+
+			client := testClient(t, func(w http.ResponseWriter, r *http.Request) {
+				// app GUIDs are their names here
+				guid := strings.Split(strings.TrimPrefix(r.URL.Path, "/v3/apps/"), "/")[0]
+
+				switch route := r.Method + " " + r.URL.Path; {
+				case route == "GET /v3/apps":
+					q := r.URL.Query()
+					names := strings.Split(q.Get("names"), ",")
+					if q.Get("space_guids") != "space-guid" || !slices.Equal(names, []string{worker, service}) {
+						t.Errorf("listed apps with %v, want just the job's in space-guid", q)
+					}
+
+					var apps []string
+					for _, n := range names {
+						if !slices.Contains(tt.missing, n) {
+							apps = append(apps, fmt.Sprintf(
+								`{"guid":%q,"name":%q,"relationships":{"space":{"data":{"guid":"space-guid"}}}}`, n, n,
+							))
+						}
+					}
+					fmt.Fprintf(w, `{"pagination":{"total_results":%d,"total_pages":1},"resources":[%v]}`,
+						len(apps), strings.Join(apps, ","))
+				case r.Method == http.MethodGet && strings.HasSuffix(r.URL.Path, "/routes"):
+					fmt.Fprint(w, `{"pagination":{"total_results":0,"total_pages":1},"resources":[]}`)
+				case r.Method == http.MethodDelete && strings.HasPrefix(r.URL.Path, "/v3/apps/"):
+					if slices.Contains(tt.failing, guid) {
+						w.WriteHeader(http.StatusBadRequest)
+						fmt.Fprint(w, `{"errors":[{"code":10008,"title":"CF-UnprocessableEntity","detail":"no"}]}`)
+						return
+					}
+					mu.Lock()
+					deleted = append(deleted, guid)
+					mu.Unlock()
+					w.Header().Set("Location", "http://"+r.Host+"/v3/jobs/job-guid")
+					w.WriteHeader(http.StatusAccepted)
+				case strings.HasPrefix(r.URL.Path, "/networking/"):
+					fmt.Fprint(w, `{"total_policies":0,"policies":[]}`)
+				default:
+					t.Errorf("unexpected request %v", route)
+					w.WriteHeader(http.StatusNotFound)
+				}
+			})
+
+			cfg := tt.cfg
+			cfg.ContainerID = worker
+			cfg.VcapAppData = VcapAppData{OrgName: "org", SpaceName: "space", SpaceID: "space-guid"}
+			cfg.WorkerOrg, cfg.WorkerSpace = "org", "space"
+			cfg.Services = []*Service{{
+				Image:    Image{Alias: "db"},
+				Manifest: &cloudgov.AppManifest{Name: service},
+			}}
+			s := &cleanupStage{client: client, config: &cfg}
+
+			err := s.exec(context.Background())
+			if len(tt.wantErr) < 1 && err != nil {
+				t.Fatalf("exec() error = %v", err)
+			}
+			for _, want := range tt.wantErr {
+				if err == nil || !strings.Contains(err.Error(), want) {
+					t.Errorf("exec() error = %v, want it to contain %q", err, want)
+				}
+			}
+			if diff := cmp.Diff(deleted, tt.wantDeletes); diff != "" {
+				t.Errorf("deletes mismatch (-got +want):\n%s", diff)
+			}
+		})
+	}
+}
@@ -1,11 +1,26 @@
 package drive
 
 import (
-	"log"
+	"encoding/json"
+	"fmt"
+	"os"
 
 	"github.com/spf13/cobra"
 )
 
+// The builds and cache dirs are paths on the worker, not the manager.
+// Each job gets its own worker app, deleted in cleanup, so no two jobs
+// ever share them and static defaults are safe.
+const (
+	driverName       = "cfd (CloudFoundry Driver)"
+	buildsDirDefault = "/tmp/build"
+	cacheDirDefault  = "/tmp/cache"
+)
+
+// DriverVersion is reported to GitLab in config_exec output.
+// `make build` sets it from `git describe` with -ldflags.
+var DriverVersion = "dev"
+
 var configCmd = &cobra.Command{
 	Use:   "config",
 	Short: "Configure various jobs settings before they run",
@@ -16,7 +31,57 @@ example, setting a build directory depending on the project ID.
 
 For a detailed list of settings that can be configured, read more at:
 https://docs.gitlab.com/runner/executors/custom.html#config.`,
-	Run: func(cmd *cobra.Command, args []string) {
-		log.Println("configuring...")
-	},
+	RunE: configure,
+}
+
+// ConfigOutput is the JSON document config_exec writes to STDOUT.
+// See: https://docs.gitlab.com/runner/executors/custom.html#config
+type ConfigOutput struct {
+	BuildsDir         string            `json:"builds_dir"`
+	CacheDir          string            `json:"cache_dir"`
+	BuildsDirIsShared bool              `json:"builds_dir_is_shared"`
+	Hostname          string            `json:"hostname"`
+	Driver            ConfigDriver      `json:"driver"`
+	JobEnv            map[string]string `json:"job_env,omitempty"`
+}
+
+type ConfigDriver struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+func configure(cmd *cobra.Command, args []string) error {
+	cfg, err := getJobConfig()
+	if err != nil {
+		return &SystemFailureError{fmt.Errorf("error initializing config stage: %w", err)}
+	}
+
+	err = json.NewEncoder(os.Stdout).Encode(cfg.configOutput())
+	if err != nil {
+		return &SystemFailureError{fmt.Errorf("error executing config stage: %w", err)}
+	}
+
+	return nil
+}
+
+func (cfg *JobConfig) configOutput() *ConfigOutput {
+	out := &ConfigOutput{
+		BuildsDir: cfg.BuildsDir,
+		CacheDir:  cfg.CacheDir,
+		// every job gets its own worker, so nothing is shared, see
+		// buildsDirDefault
+		BuildsDirIsShared: false,
+		Hostname:          cfg.ContainerID,
+		Driver:            ConfigDriver{Name: driverName, Version: DriverVersion},
+		JobEnv:            map[string]string{"CFD_CONTAINER_ID": cfg.ContainerID},
+	}
+
+	if out.BuildsDir == "" {
+		out.BuildsDir = buildsDirDefault
+	}
+	if out.CacheDir == "" {
+		out.CacheDir = cacheDirDefault
+	}
+
+	return out
 }
@@ -0,0 +1,61 @@
+package drive
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestJobConfig_configOutput(t *testing.T) {
+	tests := map[string]struct {
+		cfg  *JobConfig
+		want *ConfigOutput
+	}{
+		"uses defaults": {
+			cfg: &JobConfig{ContainerID: "glrw-p1-c2-j3"},
+			want: &ConfigOutput{
+				BuildsDir: "/tmp/build",
+				CacheDir:  "/tmp/cache",
+				Hostname:  "glrw-p1-c2-j3",
+				Driver:    ConfigDriver{Name: driverName, Version: "dev"},
+				JobEnv:    map[string]string{"CFD_CONTAINER_ID": "glrw-p1-c2-j3"},
+			},
+		},
+		"uses runner settings": {
+			cfg: &JobConfig{
+				ContainerID: "glrw-p1-c2-j3",
+				BuildsDir:   "/home/vcap/builds",
+				CacheDir:    "/home/vcap/cache",
+			},
+			want: &ConfigOutput{
+				BuildsDir: "/home/vcap/builds",
+				CacheDir:  "/home/vcap/cache",
+				Hostname:  "glrw-p1-c2-j3",
+				Driver:    ConfigDriver{Name: driverName, Version: "dev"},
+				JobEnv:    map[string]string{"CFD_CONTAINER_ID": "glrw-p1-c2-j3"},
+			},
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if diff := cmp.Diff(tt.cfg.configOutput(), tt.want); diff != "" {
+				t.Errorf("mismatch (-got +want):\n%s", diff)
+			}
+		})
+	}
+}
+
+// The static default dirs are only safe as long as no worker is shared,
+// so GitLab must never be told otherwise.
+func TestJobConfig_configOutput_json(t *testing.T) {
+	out, err := json.Marshal((&JobConfig{ContainerID: "glrw-p1-c2-j3"}).configOutput())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(out), `"builds_dir_is_shared":false`) {
+		t.Errorf("configOutput() = %s, want builds_dir_is_shared false", out)
+	}
+}
@@ -0,0 +1,152 @@
+package drive
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/GSA-TTS/gitlab-runner-cloudgov/runner-manager/cfd/cloudgov"
+)
+
+// BuildFailureError means the job itself is at fault, e.g., its image
+// isn't allowed or won't stage. Retrying won't help.
+type BuildFailureError struct {
+	Err error
+}
+
+func (e *BuildFailureError) Error() string {
+	return fmt.Sprintf("build failure: %v", e.Err)
+}
+
+func (e *BuildFailureError) Unwrap() error {
+	return e.Err
+}
+
+// ScriptExitError means a script step exited non-zero on the worker.
+// ExitCode is the remote exit code.
+type ScriptExitError struct {
+	ExitCode int
+	Err      error
+}
+
+func (e *ScriptExitError) Error() string {
+	return fmt.Sprintf("script failure (exit code %d): %v", e.ExitCode, e.Err)
+}
+
+func (e *ScriptExitError) Unwrap() error {
+	return e.Err
+}
+
+// SystemFailureError means something outside the job went wrong, e.g.,
+// we couldn't reach cloud.gov or the worker. GitLab can retry these.
+type SystemFailureError struct {
+	Err error
+}
+
+func (e *SystemFailureError) Error() string {
+	return fmt.Sprintf("system failure: %v", e.Err)
+}
+
+func (e *SystemFailureError) Unwrap() error {
+	return e.Err
+}
+
+// FailureExitCode maps err to the exit code gitlab-runner expects from a
+// Custom executor stage.
+//
+// Like run.sh, we exit with SYSTEM_FAILURE_EXIT_CODE when a script fails
+// so GitLab's `retry` can apply, and leave the script's own exit code to
+// BUILD_EXIT_CODE_FILE (see WriteBuildExitCode).
+//
+// See: https://docs.gitlab.com/runner/executors/custom/#system-failure
+func FailureExitCode(err error) int {
+	var scriptErr *ScriptExitError
+	var buildErr *BuildFailureError
+	var sysErr *SystemFailureError
+	switch {
+	case errors.As(err, &scriptErr), errors.As(err, &sysErr):
+		return exitCodeFromEnv("SYSTEM_FAILURE_EXIT_CODE")
+	case errors.As(err, &buildErr):
+		return exitCodeFromEnv("BUILD_FAILURE_EXIT_CODE")
+	}
+	return 1
+}
+
+// WriteBuildExitCode writes a failed script's exit code to
+// BUILD_EXIT_CODE_FILE so `allow_failure: exit_codes` can match it. It
+// does nothing for other errors or if gitlab-runner didn't set the file.
+//
+// See: https://docs.gitlab.com/runner/executors/custom/#build-failure-exit-code
+func WriteBuildExitCode(err error) error {
+	var scriptErr *ScriptExitError
+	f := os.Getenv("BUILD_EXIT_CODE_FILE")
+	if f == "" || !errors.As(err, &scriptErr) {
+		return nil
+	}
+
+	code := []byte(strconv.Itoa(scriptErr.ExitCode))
+	if err := os.WriteFile(f, code, 0600); err != nil {
+		return fmt.Errorf("error writing BUILD_EXIT_CODE_FILE: %w", err)
+	}
+	return nil
+}
+
+// stageFailure decides how gitlab-runner sees err from a stage: as a
+// build failure if the job itself is at fault, e.g., its image won't
+// stage, else as a system failure.
+func stageFailure(err error) error {
+	var scriptErr *ScriptExitError
+	var buildErr *BuildFailureError
+	var sysErr *SystemFailureError
+	if errors.As(err, &scriptErr) || errors.As(err, &buildErr) || errors.As(err, &sysErr) {
+		return err
+	}
+
+	// An app that won't start is down to its image or settings, unless
+	// it just took too long
+	var stateErr *cloudgov.InstanceStateError
+	if errors.Is(err, cloudgov.ErrStagingFailed) || errors.As(err, &stateErr) && stateErr.Kind != nil {
+		return &BuildFailureError{Err: err}
+	}
+	return &SystemFailureError{err}
+}
+
+// FailureHint suggests what to do about err, or "" if we've nothing to add.
+func FailureHint(err error) string {
+	var policyErr *ImagePolicyError
+	var spaceErr *cloudgov.SpaceAccessError
+	switch {
+	case errors.As(err, &policyErr):
+		return "the runner's image policy doesn't allow this image, ask the runner's admins which images are allowed"
+	case errors.As(err, &spaceErr):
+		return "check WORKER_ORG and WORKER_SPACE name a space the runner's cloud.gov service account has the SpaceDeveloper role in"
+	case errors.Is(err, cloudgov.ErrUnauthorized):
+		return "check the runner's cloud.gov service account has the SpaceDeveloper role in the job's space"
+	case errors.Is(err, cloudgov.ErrQuotaExceeded):
+		return "the space's quota is used up, try a smaller WORKER_MEMORY or WORKER_DISK, or fewer concurrent jobs"
+	case errors.Is(err, cloudgov.ErrStagingFailed):
+		return "cloud.gov couldn't stage an image, check the image name and any registry credentials"
+	case errors.Is(err, cloudgov.ErrImagePull):
+		return "cloud.gov couldn't pull an image, check the image name and any registry credentials"
+	case errors.Is(err, cloudgov.ErrOutOfMemory):
+		return "the worker or a service ran out of memory, try giving it more with WORKER_MEMORY"
+	case errors.Is(err, cloudgov.ErrHealthCheck):
+		return "a service's health check never passed, check its HEALTH_CHECK_* and SERVICE_PORTS variables"
+	case errors.Is(err, cloudgov.ErrCrashed):
+		return "the worker or a service crashed while starting, check its image, command, and variables"
+	case errors.Is(err, cloudgov.ErrNameConflict):
+		return "an app or route with this name already exists, likely left over from an earlier job"
+	case errors.Is(err, cloudgov.ErrRateLimited), errors.Is(err, cloudgov.ErrUnavailable):
+		return "cloud.gov's API is busy or unavailable, retrying the job later may help"
+	}
+	return ""
+}
+
+func exitCodeFromEnv(key string) int {
+	code, err := strconv.Atoi(os.Getenv(key))
+	if err != nil || code == 0 {
+		return 1
+	}
+	return code
+}
@@ -0,0 +1,165 @@
+package drive
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/GSA-TTS/gitlab-runner-cloudgov/runner-manager/cfd/cloudgov"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestFailureExitCode(t *testing.T) {
+	tests := map[string]struct {
+		err  error
+		want int
+	}{
+		"maps build failures": {
+			err:  &BuildFailureError{errors.New("image not allowed")},
+			want: 31,
+		},
+		"maps wrapped build failures": {
+			err: fmt.Errorf(
+				"error executing prepare stage: %w",
+				&BuildFailureError{errors.New("image not allowed")},
+			),
+			want: 31,
+		},
+		"maps system failures": {
+			err:  &SystemFailureError{errors.New("cloud.gov is down")},
+			want: 32,
+		},
+		"falls back for untyped errors": {
+			err:  errors.New("unknown flag"),
+			want: 1,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv("BUILD_FAILURE_EXIT_CODE", "31")
+			t.Setenv("SYSTEM_FAILURE_EXIT_CODE", "32")
+
+			if diff := cmp.Diff(FailureExitCode(tt.err), tt.want); diff != "" {
+				t.Errorf("mismatch (-got +want):\n%s", diff)
+			}
+		})
+	}
+}
+
+// run.sh writes a failed script's exit code to BUILD_EXIT_CODE_FILE and
+// exits with SYSTEM_FAILURE_EXIT_CODE so GitLab can retry the job.
+func TestFailureExitCode_runShParity(t *testing.T) {
+	tests := map[string]struct {
+		err      error
+		want     int
+		wantFile string
+	}{
+		"script exits": {
+			err:      &ScriptExitError{ExitCode: 42, Err: errors.New("exit status 42")},
+			want:     32,
+			wantFile: "42",
+		},
+		"wrapped script exits": {
+			err: fmt.Errorf(
+				"error executing run stage: %w",
+				&ScriptExitError{ExitCode: 7, Err: errors.New("exit status 7")},
+			),
+			want:     32,
+			wantFile: "7",
+		},
+		"build failures": {
+			err:  &BuildFailureError{errors.New("image not allowed")},
+			want: 31,
+		},
+		"system failures": {
+			err:  &SystemFailureError{errors.New("cloud.gov is down")},
+			want: 32,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			codeFile := filepath.Join(t.TempDir(), "build_exit_code")
+			t.Setenv("BUILD_EXIT_CODE_FILE", codeFile)
+			t.Setenv("BUILD_FAILURE_EXIT_CODE", "31")
+			t.Setenv("SYSTEM_FAILURE_EXIT_CODE", "32")
+
+			if err := WriteBuildExitCode(tt.err); err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(FailureExitCode(tt.err), tt.want); diff != "" {
+				t.Errorf("mismatch (-got +want):\n%s", diff)
+			}
+
+			got, err := os.ReadFile(codeFile)
+			if tt.wantFile == "" {
+				if !errors.Is(err, os.ErrNotExist) {
+					t.Errorf("BUILD_EXIT_CODE_FILE should not be written, got %q", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(string(got), tt.wantFile); diff != "" {
+				t.Errorf("mismatch (-got +want):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestFailureExitCode_withoutEnv(t *testing.T) {
+	for _, k := range []string{"BUILD_EXIT_CODE_FILE", "BUILD_FAILURE_EXIT_CODE", "SYSTEM_FAILURE_EXIT_CODE"} {
+		t.Setenv(k, "")
+	}
+
+	if got := FailureExitCode(&SystemFailureError{errors.New("fail")}); got != 1 {
+		t.Errorf("FailureExitCode() = %v, want 1", got)
+	}
+}
+
+func Test_stageFailure(t *testing.T) {
+	tests := map[string]struct {
+		err       error
+		wantBuild bool
+	}{
+		"keeps build failures": {
+			err:       &BuildFailureError{errors.New("image not allowed")},
+			wantBuild: true,
+		},
+		"blames the job for staging failures": {
+			err:       &cloudgov.APIError{Kind: cloudgov.ErrStagingFailed, Err: errors.New("bad image")},
+			wantBuild: true,
+		},
+		"blames the job for services that crash": {
+			err: fmt.Errorf("service db didn't become healthy: %w", &cloudgov.InstanceStateError{
+				Kind: cloudgov.ErrOutOfMemory,
+			}),
+			wantBuild: true,
+		},
+		"doesn't blame the job for slow services": {
+			err: &cloudgov.InstanceStateError{TimedOut: true},
+		},
+		"doesn't blame the job for API failures": {
+			err: &cloudgov.APIError{Kind: cloudgov.ErrUnavailable, Err: errors.New("down")},
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := stageFailure(tt.err)
+
+			var buildErr *BuildFailureError
+			var sysErr *SystemFailureError
+			if tt.wantBuild && !errors.As(err, &buildErr) {
+				t.Errorf("stageFailure() = %v, want a BuildFailureError", err)
+			}
+			if !tt.wantBuild && !errors.As(err, &sysErr) {
+				t.Errorf("stageFailure() = %v, want a SystemFailureError", err)
+			}
+		})
+	}
+}
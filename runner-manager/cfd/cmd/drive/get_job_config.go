@@ -3,10 +3,12 @@ package drive
 import (
 	"encoding/json"
 	"fmt"
+	"math"
 	"os"
 	"reflect"
 	"regexp"
 	"slices"
+	"strconv"
 	"strings"
 
 	"github.com/GSA-TTS/gitlab-runner-cloudgov/runner-manager/cfd/cloudgov"
@@ -24,6 +26,18 @@ type JobConfig struct {
 	EgressServiceName string `env:"PROXY_CREDENTIAL_INSTANCE"`
 
 	EgressProxyConfig
+	SSHHost string `env:"CG_SSH_HOST"`
+
+	// Where workers and services run, by default the manager's own org
+	// and space. The service account needs SpaceDeveloper there.
+	WorkerOrg   string `env:"WORKER_ORG"`
+	WorkerSpace string `env:"WORKER_SPACE"`
+
+	// The egress proxy app workers reach out through, and on which ports:
+	// "http" (8080), "https" (61443), or "both"
+	ProxyAppName    string `env:"PROXY_APP_NAME"`
+	ProxySpace      string `env:"PROXY_SPACE"`
+	WorkerProxyMode string `env:"WORKER_PROXY_MODE"`
 
 	Manifest *cloudgov.AppManifest
 
@@ -36,14 +50,73 @@ type JobConfig struct {
 	ProjectID           string `env:"CUSTOM_ENV_CI_PROJECT_ID"`
 	ConcurrentProjectID string `env:"CUSTOM_ENV_CI_CONCURRENT_PROJECT_ID"`
 
-	// TODO: #95 - we might want to grab/store these differently
-	CIRegistryUser string `env:"CUSTOM_ENV_CI_REGISTRY_USER"`
-	CIRegistryPass string `env:"CUSTOM_ENV_CI_REGISTRY_PASSWORD"`
-	DockerHubUser  string `env:"DOCKER_HUB_USER"`
-	DockerHubToken string `env:"DOCKER_HUB_TOKEN"`
-
-	WorkerMemory   string `env:"WORKER_MEMORY"`
-	WorkerDiskSize string `env:"WORKER_DISK_SIZE"`
+	// Registry creds, see credsResolver. DOCKER_AUTH_CONFIG is a docker
+	// config.json, set on the job or the runner.
+	CIRegistry          string `env:"CUSTOM_ENV_CI_REGISTRY"`
+	CIRegistryUser      string `env:"CUSTOM_ENV_CI_REGISTRY_USER"`
+	CIRegistryPass      string `env:"CUSTOM_ENV_CI_REGISTRY_PASSWORD"`
+	DockerHubUser       string `env:"DOCKER_HUB_USER"`
+	DockerHubToken      string `env:"DOCKER_HUB_TOKEN"`
+	JobDockerAuthConfig string `env:"CUSTOM_ENV_DOCKER_AUTH_CONFIG"`
+	DockerAuthConfig    string `env:"DOCKER_AUTH_CONFIG"`
+
+	// The job's image, else the runner's default for jobs without one
+	CIJobImage      string `env:"CUSTOM_ENV_CI_JOB_IMAGE"`
+	DefaultJobImage string `env:"DEFAULT_JOB_IMAGE"`
+
+	// Restricts which images jobs can run, see ImagePolicy
+	ImagePolicyFile string `env:"IMAGE_POLICY_FILE"`
+
+	WorkerMemory    string `env:"WORKER_MEMORY"`
+	WorkerDiskSize  string `env:"WORKER_DISK_SIZE"`
+	WorkerBundleDir string `env:"WORKER_BUNDLE_DIR"`
+
+	// Bounds on WORKER_MEMORY & WORKER_DISK job and service variables,
+	// e.g., "256M" or "4G"
+	WorkerMemoryMin   string `env:"WORKER_MEMORY_MIN"`
+	WorkerMemoryMax   string `env:"WORKER_MEMORY_MAX"`
+	WorkerDiskSizeMin string `env:"WORKER_DISK_SIZE_MIN"`
+	WorkerDiskSizeMax string `env:"WORKER_DISK_SIZE_MAX"`
+
+	// Ports opened to services that don't declare any, e.g., "20-10000"
+	ServicePortsFallback string `env:"SERVICE_PORTS_FALLBACK"`
+	// How long services get to become healthy, e.g., "300" or "5m"
+	ServiceStartTimeout string `env:"SERVICE_START_TIMEOUT"`
+	// How many services to push at once
+	ServicePushConcurrency string `env:"SERVICE_PUSH_CONCURRENCY"`
+
+	// Runner settings from the manager's env, reported in config_exec
+	BuildsDir string `env:"RUNNER_BUILDS_DIR"`
+	CacheDir  string `env:"RUNNER_CACHE_DIR"`
+
+	// Retries of transient CF API failures: total attempts, e.g., "4",
+	// and the longest to back off between them, e.g., "30s"
+	CFRetryAttempts string `env:"CF_RETRY_ATTEMPTS"`
+	CFRetryMaxDelay string `env:"CF_RETRY_MAX_DELAY"`
+
+	// Per-stage deadlines, e.g., "600" or "30m"
+	PrepareTimeout string `env:"PREPARE_TIMEOUT"`
+	RunTimeout     string `env:"RUN_TIMEOUT"`
+	CleanupTimeout string `env:"CLEANUP_TIMEOUT"`
+
+	// Set to "true" to skip deleting apps in cleanup, e.g., for debugging
+	PreserveWorker   string `env:"CUSTOM_ENV_PRESERVE_WORKER"`
+	PreserveServices string `env:"CUSTOM_ENV_PRESERVE_SERVICES"`
+
+	// Set to "true" to print services' logs in the job log as they run
+	StreamServiceLogs string `env:"CUSTOM_ENV_STREAM_SERVICE_LOGS"`
+
+	// Set to "true", by the runner or a job, to trace job scripts and
+	// keep their file variables. Only for jobs run by RUNNER_DEBUG_USERS,
+	// a space-separated list of emails, as traces can leak secrets.
+	RunnerDebug      string `env:"RUNNER_DEBUG"`
+	JobRunnerDebug   string `env:"CUSTOM_ENV_RUNNER_DEBUG"`
+	RunnerDebugUsers string `env:"RUNNER_DEBUG_USERS"`
+	GitlabUserEmail  string `env:"CUSTOM_ENV_GITLAB_USER_EMAIL"`
+
+	// For the job log, printed in prepare. Not on stdout here, as the
+	// config stage's stdout is read by gitlab-runner.
+	Warnings []string
 }
 
 type JobResponse struct {
@@ -62,18 +135,27 @@ type Service struct {
 	Variables []CIVar
 	Manifest  *cloudgov.AppManifest
 	Config    *JobConfig
+	App       *cloudgov.App // set once pushed in prepare
 }
 type CIVar struct {
 	Key   string
 	Value string
 }
 
-// match images w/ docker domain, or no domain (i.e. docker by default)
-var domainRegex = regexp.MustCompile(`^((registry-\d+|index)?\.?docker\.io\/|[^.]*(:|$))`)
+// ciVar gets the value of the last var in vars with key, as later
+// definitions override earlier ones.
+func ciVar(vars []CIVar, key string) (val string, ok bool) {
+	for _, v := range vars {
+		if v.Key == key {
+			val, ok = v.Value, true
+		}
+	}
+	return val, ok
+}
 
 type VcapAppData struct {
 	CFApi     string `json:"cf_api"`
-	OrgID     string `json:"org_id"`
+	OrgID     string `json:"organization_id"`
 	OrgName   string `json:"organization_name"`
 	SpaceID   string `json:"space_id"`
 	SpaceName string `json:"space_name"`
@@ -172,15 +254,15 @@ func (c *JobConfig) parseEnv() *JobConfig {
 	return c
 }
 
-func (cfg *JobConfig) makeManifest(id string) *cloudgov.AppManifest {
+func (cfg *JobConfig) makeManifest(id string, memory string, disk string) *cloudgov.AppManifest {
 	return &cloudgov.AppManifest{
 		Name:      id,
-		OrgName:   cfg.OrgName,
-		SpaceName: cfg.SpaceName,
+		OrgName:   cfg.WorkerOrg,
+		SpaceName: cfg.WorkerSpace,
 		NoRoute:   true,
 		Process: cloudgov.AppManifestProcess{
-			Memory:          cfg.WorkerMemory,
-			DiskQuota:       cfg.WorkerDiskSize,
+			Memory:          memory,
+			DiskQuota:       disk,
 			HealthCheckType: "process",
 		},
 	}
@@ -190,33 +272,195 @@ func (cfg *JobConfig) ciVarsToMap(vars []CIVar, m *cloudgov.AppManifest) {
 	if vars == nil {
 		return
 	}
-	m.Env = make(map[string]string)
+	if m.Env == nil {
+		m.Env = make(map[string]string)
+	}
 	for _, v := range vars {
 		m.Env[v.Key] = v.Value
 	}
 }
 
-func (cfg *JobConfig) processImage(img Image, m *cloudgov.AppManifest) {
+func (cfg *JobConfig) serviceID(alias string) string {
+	return fmt.Sprintf("%v-svc-%v", cfg.ContainerID, alias)
+}
+
+var (
+	wsrAliasRegex = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+	wsrRefRegex   = regexp.MustCompile(`\$(?:\{(WSR_SERVICE_[a-zA-Z0-9_]+)\}|(WSR_SERVICE_[a-zA-Z0-9_]+))`)
+)
+
+// wsrVars makes WSR_SERVICE_ID_<alias> & WSR_SERVICE_HOST_<alias> for each
+// service so containers can find each other. Characters in an alias that
+// can't be in a variable name become "_", e.g., "my-db" -> "my_db".
+func (cfg *JobConfig) wsrVars() map[string]string {
+	if len(cfg.Services) < 1 {
+		return nil
+	}
+
+	vars := make(map[string]string, 2*len(cfg.Services))
+	for _, s := range cfg.Services {
+		name := wsrAliasRegex.ReplaceAllString(s.Alias, "_")
+		id := cfg.serviceID(s.Alias)
+		vars["WSR_SERVICE_ID_"+name] = id
+		vars["WSR_SERVICE_HOST_"+name] = id + ".apps.internal"
+	}
+	return vars
+}
+
+func (cfg *JobConfig) wsrVarsToMap(wsr map[string]string, m *cloudgov.AppManifest) {
+	if len(wsr) < 1 {
+		return
+	}
+	if m.Env == nil {
+		m.Env = make(map[string]string)
+	}
+	for k, v := range wsr {
+		m.Env[k] = v
+	}
+}
+
+// expandWSRVars replaces $WSR_SERVICE_* and ${WSR_SERVICE_*} references
+// in m's env with their values, leaving unknown references alone.
+func (cfg *JobConfig) expandWSRVars(wsr map[string]string, m *cloudgov.AppManifest) {
+	for k, v := range m.Env {
+		m.Env[k] = wsrRefRegex.ReplaceAllStringFunc(v, func(ref string) string {
+			sm := wsrRefRegex.FindStringSubmatch(ref)
+			name := sm[1] + sm[2]
+			if val, ok := wsr[name]; ok {
+				return val
+			}
+			return ref
+		})
+	}
+}
+
+func (cfg *JobConfig) processImage(img Image, m *cloudgov.AppManifest, creds CredsResolver) error {
 	if img.Name != "" {
+		ref, err := parseImageRef(img.Name)
+		if err != nil {
+			return err
+		}
 		m.Docker.Image = img.Name
 
-		// TODO: #95
-		if strings.Contains(img.Name, "registry.gitlab.com") {
-			m.Docker.Username = cfg.CIRegistryUser
-			m.Docker.Password = cfg.CIRegistryPass
-		} else if domainRegex.FindString(img.Name) != "" {
-			m.Docker.Username = cfg.DockerHubUser
-			m.Docker.Password = cfg.DockerHubToken
+		if c, ok := creds.Resolve(ref.Registry); ok {
+			m.Docker.Username = c.Username
+			m.Docker.Password = c.Password
 		}
 
-		var x []string
-		for _, str := range append(img.Entrypoint, img.Command...) {
-			str = strings.Trim(str, " ")
-			if str != "" {
-				x = append(x, str)
-			}
+		if len(img.Entrypoint) < 1 && len(img.Command) > 0 {
+			// docker passes a command alone to the image's ENTRYPOINT
+			m.Process.Args = img.Command
+		} else {
+			m.Process.Command = cloudgov.StartCommand(img.Entrypoint, img.Command)
 		}
-		m.Process.Command = strings.Join(x, " ")
+	}
+	return nil
+}
+
+// Service variables overriding how CF runs and health checks a service
+const (
+	healthCheckTypeVar              = "HEALTH_CHECK_TYPE"
+	healthCheckHTTPEndpointVar      = "HEALTH_CHECK_HTTP_ENDPOINT"
+	healthCheckTimeoutVar           = "HEALTH_CHECK_TIMEOUT"
+	healthCheckInvocationTimeoutVar = "HEALTH_CHECK_INVOCATION_TIMEOUT"
+	serviceInstancesVar             = "SERVICE_INSTANCES"
+)
+
+// processServiceVars applies a service's health check and instance
+// overrides to p, e.g., HEALTH_CHECK_TYPE=http with
+// HEALTH_CHECK_HTTP_ENDPOINT=/healthz. Timeouts are seconds or durations.
+func processServiceVars(vars []CIVar, p *cloudgov.AppManifestProcess) error {
+	if v, ok := ciVar(vars, healthCheckTypeVar); ok {
+		switch v {
+		case "port", "process", "http":
+			p.HealthCheckType = v
+		default:
+			return fmt.Errorf("invalid %v %q, want \"port\", \"process\", or \"http\"", healthCheckTypeVar, v)
+		}
+	}
+
+	if v, ok := ciVar(vars, healthCheckHTTPEndpointVar); ok {
+		if p.HealthCheckType != "http" {
+			return fmt.Errorf("%v needs %v=http", healthCheckHTTPEndpointVar, healthCheckTypeVar)
+		}
+		if !strings.HasPrefix(v, "/") {
+			return fmt.Errorf("invalid %v %q, want a path, e.g., \"/healthz\"", healthCheckHTTPEndpointVar, v)
+		}
+		p.HealthCheckHTTPEndpoint = v
+	}
+
+	timeouts := []struct {
+		key string
+		dst *uint
+	}{
+		{healthCheckTimeoutVar, &p.HealthCheckTimeout},
+		{healthCheckInvocationTimeoutVar, &p.HealthCheckInvocationTimeout},
+	}
+	for _, t := range timeouts {
+		v, ok := ciVar(vars, t.key)
+		if !ok {
+			continue
+		}
+		d, err := parseTimeout(t.key, v, 0)
+		if err != nil {
+			return err
+		}
+		// CF counts whole seconds
+		*t.dst = uint(math.Ceil(d.Seconds()))
+	}
+
+	if v, ok := ciVar(vars, serviceInstancesVar); ok {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return fmt.Errorf("invalid %v %q, want a number over 0", serviceInstancesVar, v)
+		}
+		p.Instances = uint(n)
+	}
+
+	return nil
+}
+
+const (
+	defaultJobImageFallback = "ubuntu:24.04"
+
+	// Workers need something to keep running, images like ubuntu's
+	// default to shells that exit without a terminal
+	workerStartCommandFallback = "/bin/sh"
+)
+
+// runnerDebug reports whether RUNNER_DEBUG is on and the job's user is
+// allowed it.
+func (cfg *JobConfig) runnerDebug() bool {
+	if cfg.RunnerDebug != "true" && cfg.JobRunnerDebug != "true" {
+		return false
+	}
+	return slices.Contains(strings.Fields(cfg.RunnerDebugUsers), cfg.GitlabUserEmail)
+}
+
+// setWorkerSpace defaults WORKER_ORG and WORKER_SPACE to the manager's.
+func (cfg *JobConfig) setWorkerSpace() {
+	if cfg.WorkerOrg == "" {
+		cfg.WorkerOrg = cfg.OrgName
+	}
+	if cfg.WorkerSpace == "" {
+		cfg.WorkerSpace = cfg.SpaceName
+	}
+}
+
+// setJobImage picks the job's image: CI_JOB_IMAGE, else the image in the
+// job response, else the runner's DEFAULT_JOB_IMAGE, else our fallback.
+func (cfg *JobConfig) setJobImage() {
+	switch {
+	case cfg.CIJobImage != "":
+		cfg.Image.Name = cfg.CIJobImage
+	case cfg.Image.Name != "":
+	case cfg.DefaultJobImage != "":
+		cfg.Image.Name = cfg.DefaultJobImage
+	default:
+		cfg.Image.Name = defaultJobImageFallback
+		cfg.Warnings = append(cfg.Warnings, fmt.Sprintf(
+			"DEFAULT_JOB_IMAGE not set! Falling back to %v", defaultJobImageFallback,
+		))
 	}
 }
 
@@ -256,6 +500,16 @@ func (cfg *JobConfig) processEgressProxyCfg() (err error) {
 	return os.WriteFile(cfg.ProxyAuthFile, []byte(esc.CredString), 0600)
 }
 
+// setContainerID names the job's worker, and by it, its services.
+func (cfg *JobConfig) setContainerID() {
+	cfg.ContainerID = fmt.Sprintf(
+		"glrw-p%v-c%v-j%v",
+		cfg.ProjectID,
+		cfg.ConcurrentProjectID,
+		cfg.JobID,
+	)
+}
+
 func getJobConfig() (cfg *JobConfig, err error) {
 	defer func() {
 		if err != nil {
@@ -271,6 +525,7 @@ func getJobConfig() (cfg *JobConfig, err error) {
 	if err = cfg.parseVcapAppJSON(); err != nil {
 		return nil, err
 	}
+	cfg.setWorkerSpace()
 	if err = cfg.parseVcapServicesJSON(); err != nil {
 		return nil, err
 	}
@@ -278,22 +533,73 @@ func getJobConfig() (cfg *JobConfig, err error) {
 		return nil, err
 	}
 
-	cfg.ContainerID = fmt.Sprintf(
-		"glrw-p%v-c%v-j%v",
-		cfg.ProjectID,
-		cfg.ConcurrentProjectID,
-		cfg.JobID,
-	)
+	cfg.setContainerID()
 
-	cfg.Manifest = cfg.makeManifest(cfg.ContainerID)
+	// All of these are needed before making any manifests
+	wsr := cfg.wsrVars()
+	creds, err := cfg.credsResolver()
+	if err != nil {
+		return nil, err
+	}
+
+	memory, disk, err := cfg.workerSizes(cfg.Variables)
+	if err != nil {
+		return nil, err
+	}
+	cfg.Manifest = cfg.makeManifest(cfg.ContainerID, memory, disk)
+	cfg.wsrVarsToMap(wsr, cfg.Manifest)
 	cfg.ciVarsToMap(cfg.Variables, cfg.Manifest)
-	cfg.processImage(cfg.Image, cfg.Manifest)
+	cfg.setJobImage()
+	if err = cfg.processImage(cfg.Image, cfg.Manifest, creds); err != nil {
+		return nil, err
+	}
+	if cfg.Manifest.Process.Command == "" && len(cfg.Manifest.Process.Args) < 1 {
+		cfg.Manifest.Process.Command = workerStartCommandFallback
+	}
 
 	for _, s := range cfg.Services {
-		serviceId := fmt.Sprintf("%v-svc-%v", cfg.ContainerID, s.Alias)
-		s.Manifest = cfg.makeManifest(serviceId)
+		memory, disk, err := cfg.workerSizes(s.Variables)
+		if err != nil {
+			return nil, fmt.Errorf("service %v: %w", s.Alias, err)
+		}
+		s.Manifest = cfg.makeManifest(cfg.serviceID(s.Alias), memory, disk)
+		if err = processServiceVars(s.Variables, &s.Manifest.Process); err != nil {
+			return nil, fmt.Errorf("service %v: %w", s.Alias, err)
+		}
+		cfg.wsrVarsToMap(wsr, s.Manifest)
 		cfg.ciVarsToMap(append(cfg.Variables, s.Variables...), s.Manifest)
-		cfg.processImage(s.Image, s.Manifest)
+		cfg.expandWSRVars(wsr, s.Manifest)
+		if err = cfg.processImage(s.Image, s.Manifest, creds); err != nil {
+			return nil, err
+		}
+	}
+
+	return cfg, nil
+}
+
+// getCleanupConfig gets just what cleanup needs to find the job's apps:
+// their names and space. Cleanup must still run if, e.g., a job's sizes
+// or registry creds are invalid, as prepare may have pushed apps anyway.
+func getCleanupConfig() (cfg *JobConfig, err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("error getting job config: %w", err)
+		}
+	}()
+
+	cfg = (&JobConfig{}).parseEnv()
+
+	if err = cfg.parseJobResponseFile(); err != nil {
+		return nil, err
+	}
+	if err = cfg.parseVcapAppJSON(); err != nil {
+		return nil, err
+	}
+	cfg.setWorkerSpace()
+	cfg.setContainerID()
+
+	for _, s := range cfg.Services {
+		s.Manifest = &cloudgov.AppManifest{Name: cfg.serviceID(s.Alias)}
 	}
 
 	return cfg, nil
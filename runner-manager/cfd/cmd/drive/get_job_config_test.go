@@ -14,7 +14,7 @@ import (
 // think about that later.
 func Test_GetJobConfig(t *testing.T) {
 	cfgWant := &JobConfig{
-		JobResponse:      JobResponse{},
+		JobResponse:      JobResponse{Image: Image{Name: "ubuntu:24.04"}},
 		CIRegistryUser:   "foo",
 		CIRegistryPass:   "bar",
 		DockerHubUser:    "foo",
@@ -28,10 +28,13 @@ func Test_GetJobConfig(t *testing.T) {
 		Manifest: &cloudgov.AppManifest{
 			Name:    "glrw-p-c-j",
 			NoRoute: true,
+			Docker:  cloudgov.AppManifestDocker{Image: "ubuntu:24.04", Username: "foo", Password: "1234"},
 			Process: cloudgov.AppManifestProcess{
+				Command:   "/bin/sh",
 				DiskQuota: "1024M", Memory: "1024M", HealthCheckType: "process",
 			},
 		},
+		Warnings: []string{"DEFAULT_JOB_IMAGE not set! Falling back to ubuntu:24.04"},
 	}
 
 	envVarsToSet := map[string]string{
@@ -76,8 +79,13 @@ func Test_parseJobResponseFile(t *testing.T) {
 			},
 			Variables: []CIVar{{Key: "bazz", Value: "buzz"}},
 			Manifest: &cloudgov.AppManifest{
-				Name:    "glrw-p-c-j-svc-my-pg-service",
-				Env:     map[string]string{"bazz": "buzz", "foo": "bar"},
+				Name: "glrw-p-c-j-svc-my-pg-service",
+				Env: map[string]string{
+					"bazz":                           "buzz",
+					"foo":                            "bar",
+					"WSR_SERVICE_ID_my_pg_service":   "glrw-p-c-j-svc-my-pg-service",
+					"WSR_SERVICE_HOST_my_pg_service": "glrw-p-c-j-svc-my-pg-service.apps.internal",
+				},
 				NoRoute: true,
 				Docker:  cloudgov.AppManifestDocker{Image: "postgres:wormy"},
 				Process: cloudgov.AppManifestProcess{Command: "j k l g h i", HealthCheckType: "process"},
@@ -87,8 +95,12 @@ func Test_parseJobResponseFile(t *testing.T) {
 				JobResponseFile:  "./testdata/sample_job_response.json",
 				VcapServicesData: VcapServicesData{},
 				Manifest: &cloudgov.AppManifest{
-					Name:    "glrw-p-c-j",
-					Env:     map[string]string{"foo": "bar"},
+					Name: "glrw-p-c-j",
+					Env: map[string]string{
+						"foo":                            "bar",
+						"WSR_SERVICE_ID_my_pg_service":   "glrw-p-c-j-svc-my-pg-service",
+						"WSR_SERVICE_HOST_my_pg_service": "glrw-p-c-j-svc-my-pg-service.apps.internal",
+					},
 					NoRoute: true,
 					Docker:  cloudgov.AppManifestDocker{Image: "ubuntu:jammy"},
 					Process: cloudgov.AppManifestProcess{Command: "d e f a b c", HealthCheckType: "process"},
@@ -111,12 +123,42 @@ func Test_parseJobResponseFile(t *testing.T) {
 	}
 }
 
+func Test_getCleanupConfig(t *testing.T) {
+	t.Setenv("JOB_RESPONSE_FILE", "./testdata/sample_job_response.json")
+	t.Setenv("VCAP_APPLICATION", `{"organization_name":"org","space_name":"space","space_id":"space-guid"}`)
+	t.Setenv("CUSTOM_ENV_CI_PROJECT_ID", "1")
+	t.Setenv("CUSTOM_ENV_CI_CONCURRENT_PROJECT_ID", "2")
+	t.Setenv("CUSTOM_ENV_CI_JOB_ID", "3")
+	// nothing cleanup needs, so they mustn't stop it
+	t.Setenv("WORKER_MEMORY", "lots")
+	t.Setenv("DOCKER_AUTH_CONFIG", "{")
+
+	if _, err := getJobConfig(); err == nil {
+		t.Fatal("getJobConfig() should fail with this config")
+	}
+
+	cfg, err := getCleanupConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := []string{cfg.ContainerID, cfg.WorkerOrg, cfg.WorkerSpace, cfg.SpaceID}
+	for _, s := range cfg.Services {
+		got = append(got, s.Manifest.Name)
+	}
+	want := []string{"glrw-p1-c2-j3", "org", "space", "space-guid", "glrw-p1-c2-j3-svc-my-pg-service"}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("mismatch (-got +want):\n%s", diff)
+	}
+}
+
 func Test_parseVcapAppJSON(t *testing.T) {
 	sample := `{"cf_api":"https://api.fr.cloud.gov","limits":{"fds":16384,"mem":128,"disk":1024},"application_name":"gitlab-runner","application_uris":[],"name":"gitlab-runner","space_name":"zjr-gl-test","space_id":"8969a4b6-01aa-431d-9790-77cc4c47e3e7","organization_id":"f0a46189-6f64-43fb-99c3-0719cf9ee255","organization_name":"gsa-tts-devtools-prototyping","uris":[],"process_id":"e905fbb9-aea0-44aa-ba10-f76aed1668d1","process_type":"web","application_id":"e905fbb9-aea0-44aa-ba10-f76aed1668d1","version":"f115779a-17a3-4700-9941-aae3fe81a4c8","application_version":"f115779a-17a3-4700-9941-aae3fe81a4c8"}`
 	t.Setenv("VCAP_APPLICATION", sample)
 
 	wanted := VcapAppData{
 		CFApi:     "https://api.fr.cloud.gov",
+		OrgID:     "f0a46189-6f64-43fb-99c3-0719cf9ee255",
 		OrgName:   "gsa-tts-devtools-prototyping",
 		SpaceID:   "8969a4b6-01aa-431d-9790-77cc4c47e3e7",
 		SpaceName: "zjr-gl-test",
@@ -198,3 +240,276 @@ func Test_parseVcapServicesJSON(t *testing.T) {
 		t.Fatalf("mismatch (-got +want):\n%s", diff)
 	}
 }
+
+func TestJobConfig_expandWSRVars(t *testing.T) {
+	cfg := &JobConfig{
+		ContainerID: "glrw-p1-c2-j3",
+		JobResponse: JobResponse{
+			Services: []*Service{
+				{Image: Image{Alias: "db"}},
+				{Image: Image{Alias: "selenium-hub"}},
+			},
+		},
+	}
+
+	wsr := cfg.wsrVars()
+
+	wantWSR := map[string]string{
+		"WSR_SERVICE_ID_db":             "glrw-p1-c2-j3-svc-db",
+		"WSR_SERVICE_HOST_db":           "glrw-p1-c2-j3-svc-db.apps.internal",
+		"WSR_SERVICE_ID_selenium_hub":   "glrw-p1-c2-j3-svc-selenium-hub",
+		"WSR_SERVICE_HOST_selenium_hub": "glrw-p1-c2-j3-svc-selenium-hub.apps.internal",
+	}
+	if diff := cmp.Diff(wsr, wantWSR); diff != "" {
+		t.Fatalf("mismatch (-got +want):\n%s", diff)
+	}
+
+	m := &cloudgov.AppManifest{Env: map[string]string{
+		"DB_URL":  "postgres://$WSR_SERVICE_HOST_db:5432/test",
+		"HUB_URL": "http://${WSR_SERVICE_HOST_selenium_hub}:4444",
+		"BOTH":    "$WSR_SERVICE_ID_db,$WSR_SERVICE_ID_selenium_hub",
+		"UNKNOWN": "$WSR_SERVICE_HOST_cache",
+		"PLAIN":   "$HOME",
+	}}
+
+	cfg.expandWSRVars(wsr, m)
+
+	want := map[string]string{
+		"DB_URL":  "postgres://glrw-p1-c2-j3-svc-db.apps.internal:5432/test",
+		"HUB_URL": "http://glrw-p1-c2-j3-svc-selenium-hub.apps.internal:4444",
+		"BOTH":    "glrw-p1-c2-j3-svc-db,glrw-p1-c2-j3-svc-selenium-hub",
+		"UNKNOWN": "$WSR_SERVICE_HOST_cache",
+		"PLAIN":   "$HOME",
+	}
+	if diff := cmp.Diff(m.Env, want); diff != "" {
+		t.Errorf("mismatch (-got +want):\n%s", diff)
+	}
+}
+
+func TestJobConfig_setJobImage(t *testing.T) {
+	tests := map[string]struct {
+		cfg          JobConfig
+		want         string
+		wantWarnings []string
+	}{
+		"prefers CI_JOB_IMAGE": {
+			cfg: JobConfig{
+				CIJobImage:      "alpine:3",
+				JobResponse:     JobResponse{Image: Image{Name: "alpine:$VERSION"}},
+				DefaultJobImage: "debian:12",
+			},
+			want: "alpine:3",
+		},
+		"uses the job response's image": {
+			cfg: JobConfig{
+				JobResponse:     JobResponse{Image: Image{Name: "alpine:3"}},
+				DefaultJobImage: "debian:12",
+			},
+			want: "alpine:3",
+		},
+		"falls back to DEFAULT_JOB_IMAGE": {
+			cfg:  JobConfig{DefaultJobImage: "debian:12"},
+			want: "debian:12",
+		},
+		"falls back to ubuntu with a warning": {
+			want:         "ubuntu:24.04",
+			wantWarnings: []string{"DEFAULT_JOB_IMAGE not set! Falling back to ubuntu:24.04"},
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			tt.cfg.setJobImage()
+			if tt.cfg.Image.Name != tt.want {
+				t.Errorf("setJobImage() image = %v, want %v", tt.cfg.Image.Name, tt.want)
+			}
+			if diff := cmp.Diff(tt.cfg.Warnings, tt.wantWarnings); diff != "" {
+				t.Errorf("mismatch (-got +want):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestJobConfig_processImage_start(t *testing.T) {
+	tests := map[string]struct {
+		img  Image
+		want cloudgov.AppManifestProcess
+	}{
+		"leaves the image's start alone": {},
+		"passes the command to the entrypoint": {
+			img:  Image{Entrypoint: []string{"docker-entrypoint.sh"}, Command: []string{"postgres"}},
+			want: cloudgov.AppManifestProcess{Command: "docker-entrypoint.sh postgres"},
+		},
+		"passes a command alone to the image's entrypoint": {
+			img:  Image{Command: []string{"postgres", "-c", "fsync=off"}},
+			want: cloudgov.AppManifestProcess{Args: []string{"postgres", "-c", "fsync=off"}},
+		},
+		"runs a command alone after a reset entrypoint": {
+			img:  Image{Entrypoint: []string{""}, Command: []string{"redis-server"}},
+			want: cloudgov.AppManifestProcess{Command: "redis-server"},
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			cfg := &JobConfig{}
+			m := &cloudgov.AppManifest{}
+			tt.img.Name = "postgres:16"
+			if err := cfg.processImage(tt.img, m, credsChain{}); err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(m.Process, tt.want); diff != "" {
+				t.Errorf("mismatch (-got +want):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestJobConfig_runnerDebug(t *testing.T) {
+	users := "admin@example.gov dev@example.gov"
+
+	tests := map[string]struct {
+		cfg  JobConfig
+		want bool
+	}{
+		"is off by default": {cfg: JobConfig{RunnerDebugUsers: users, GitlabUserEmail: "dev@example.gov"}},
+		"is on from the runner for allowed users": {
+			cfg:  JobConfig{RunnerDebug: "true", RunnerDebugUsers: users, GitlabUserEmail: "dev@example.gov"},
+			want: true,
+		},
+		"is on from the job for allowed users": {
+			cfg:  JobConfig{JobRunnerDebug: "true", RunnerDebugUsers: users, GitlabUserEmail: "admin@example.gov"},
+			want: true,
+		},
+		"is off for other users": {
+			cfg: JobConfig{RunnerDebug: "true", RunnerDebugUsers: users, GitlabUserEmail: "eve@example.gov"},
+		},
+		"is off without allowed users": {
+			cfg: JobConfig{RunnerDebug: "true"},
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := tt.cfg.runnerDebug(); got != tt.want {
+				t.Errorf("runnerDebug() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestJobConfig_setWorkerSpace(t *testing.T) {
+	tests := map[string]struct {
+		cfg       JobConfig
+		wantOrg   string
+		wantSpace string
+	}{
+		"defaults to the manager's space": {
+			cfg:       JobConfig{VcapAppData: VcapAppData{OrgName: "org", SpaceName: "space"}},
+			wantOrg:   "org",
+			wantSpace: "space",
+		},
+		"keeps WORKER_ORG and WORKER_SPACE": {
+			cfg: JobConfig{
+				VcapAppData: VcapAppData{OrgName: "org", SpaceName: "space"},
+				WorkerOrg:   "other-org",
+				WorkerSpace: "workers",
+			},
+			wantOrg:   "other-org",
+			wantSpace: "workers",
+		},
+		"mixes the two": {
+			cfg: JobConfig{
+				VcapAppData: VcapAppData{OrgName: "org", SpaceName: "space"},
+				WorkerSpace: "workers",
+			},
+			wantOrg:   "org",
+			wantSpace: "workers",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			tt.cfg.setWorkerSpace()
+			if tt.cfg.WorkerOrg != tt.wantOrg || tt.cfg.WorkerSpace != tt.wantSpace {
+				t.Errorf(
+					"setWorkerSpace() = %v/%v, want %v/%v",
+					tt.cfg.WorkerOrg, tt.cfg.WorkerSpace, tt.wantOrg, tt.wantSpace,
+				)
+			}
+		})
+	}
+}
+
+func Test_processServiceVars(t *testing.T) {
+	tests := map[string]struct {
+		vars    []CIVar
+		want    cloudgov.AppManifestProcess
+		wantErr bool
+	}{
+		"keeps defaults without overrides": {
+			want: cloudgov.AppManifestProcess{HealthCheckType: "process"},
+		},
+		"sets an http health check": {
+			vars: []CIVar{
+				{Key: "HEALTH_CHECK_TYPE", Value: "http"},
+				{Key: "HEALTH_CHECK_HTTP_ENDPOINT", Value: "/healthz"},
+				{Key: "HEALTH_CHECK_TIMEOUT", Value: "2m"},
+				{Key: "HEALTH_CHECK_INVOCATION_TIMEOUT", Value: "5"},
+			},
+			want: cloudgov.AppManifestProcess{
+				HealthCheckType:              "http",
+				HealthCheckHTTPEndpoint:      "/healthz",
+				HealthCheckTimeout:           120,
+				HealthCheckInvocationTimeout: 5,
+			},
+		},
+		"rounds timeouts up to seconds": {
+			vars: []CIVar{{Key: "HEALTH_CHECK_INVOCATION_TIMEOUT", Value: "1500ms"}},
+			want: cloudgov.AppManifestProcess{HealthCheckType: "process", HealthCheckInvocationTimeout: 2},
+		},
+		"sets instances": {
+			vars: []CIVar{{Key: "SERVICE_INSTANCES", Value: "2"}},
+			want: cloudgov.AppManifestProcess{HealthCheckType: "process", Instances: 2},
+		},
+		"fails with unknown health check types": {
+			vars:    []CIVar{{Key: "HEALTH_CHECK_TYPE", Value: "tcp"}},
+			wantErr: true,
+		},
+		"fails with an endpoint for non-http checks": {
+			vars:    []CIVar{{Key: "HEALTH_CHECK_HTTP_ENDPOINT", Value: "/healthz"}},
+			wantErr: true,
+		},
+		"fails with an endpoint that isn't a path": {
+			vars: []CIVar{
+				{Key: "HEALTH_CHECK_TYPE", Value: "http"},
+				{Key: "HEALTH_CHECK_HTTP_ENDPOINT", Value: "healthz"},
+			},
+			wantErr: true,
+		},
+		"fails with malformed timeouts": {
+			vars:    []CIVar{{Key: "HEALTH_CHECK_TIMEOUT", Value: "soon"}},
+			wantErr: true,
+		},
+		"fails with zero instances": {
+			vars:    []CIVar{{Key: "SERVICE_INSTANCES", Value: "0"}},
+			wantErr: true,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := cloudgov.AppManifestProcess{HealthCheckType: "process"}
+			err := processServiceVars(tt.vars, &got)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("processServiceVars() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if diff := cmp.Diff(got, tt.want); diff != "" {
+				t.Errorf("mismatch (-got +want):\n%s", diff)
+			}
+		})
+	}
+}
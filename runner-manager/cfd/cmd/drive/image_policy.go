@@ -0,0 +1,165 @@
+package drive
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"slices"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ImagePolicy restricts the images jobs and services can run. Empty
+// lists allow anything. It's read from IMAGE_POLICY_FILE, as YAML or
+// JSON, e.g.,
+//
+//	allowed_registries: [ghcr.io, docker.io]
+//	allowed_repositories: ["docker.io/library/*", "ghcr.io/gsa-tts/*"]
+//	require_digest: false
+//	banned_tags: [latest]
+//	audit_only: true
+type ImagePolicy struct {
+	// Registries as in ImageRef, e.g., "docker.io" or "localhost:5000"
+	AllowedRegistries []string `yaml:"allowed_registries"`
+	// path.Match globs on ImageRef.Name, e.g., "docker.io/library/*";
+	// "*" doesn't match "/"
+	AllowedRepositories []string `yaml:"allowed_repositories"`
+	// Images must be pinned, e.g., "postgres@sha256:..."
+	RequireDigest bool `yaml:"require_digest"`
+	// Tags that can't be used, an image without tag or digest is "latest"
+	BannedTags []string `yaml:"banned_tags"`
+	// Report violations in the job log but run the job anyway
+	AuditOnly bool `yaml:"audit_only"`
+}
+
+// ImagePolicyError is an image that broke a rule of an ImagePolicy.
+// Rule is the name of the setting, e.g., "banned_tags".
+type ImagePolicyError struct {
+	Image  string
+	Alias  string // for services
+	Rule   string
+	Reason string
+}
+
+func (e *ImagePolicyError) Error() string {
+	img := fmt.Sprintf("image %q", e.Image)
+	if e.Alias != "" {
+		img = fmt.Sprintf("service %v image %q", e.Alias, e.Image)
+	}
+	return fmt.Sprintf("%v violates image policy rule %v: %v", img, e.Rule, e.Reason)
+}
+
+func loadImagePolicy(file string) (p *ImagePolicy, err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("error loading image policy: %w", err)
+		}
+	}()
+
+	if file == "" {
+		return nil, nil
+	}
+
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	// JSON is YAML, so this reads either. A misspelled rule would be
+	// one we don't enforce, so unknown keys are errors.
+	p = &ImagePolicy{}
+	dec := yaml.NewDecoder(bytes.NewReader(b))
+	dec.KnownFields(true)
+	if err = dec.Decode(p); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+
+	for _, glob := range p.AllowedRepositories {
+		if _, err = path.Match(glob, ""); err != nil {
+			return nil, fmt.Errorf("allowed_repositories %q: %w", glob, err)
+		}
+	}
+	for i, r := range p.AllowedRegistries {
+		p.AllowedRegistries[i] = normalizeRegistryHost(r)
+	}
+	return p, nil
+}
+
+// check returns the rules ref breaks, or nil if it's allowed.
+func (p *ImagePolicy) check(ref *ImageRef) (broken []*ImagePolicyError) {
+	if p == nil {
+		return nil
+	}
+	breaks := func(rule string, format string, a ...any) {
+		broken = append(broken, &ImagePolicyError{Rule: rule, Reason: fmt.Sprintf(format, a...)})
+	}
+
+	if len(p.AllowedRegistries) > 0 && !slices.Contains(p.AllowedRegistries, ref.Registry) {
+		breaks("allowed_registries", "registry %v isn't allowed", ref.Registry)
+	}
+
+	if len(p.AllowedRepositories) > 0 && !slices.ContainsFunc(p.AllowedRepositories, func(glob string) bool {
+		ok, _ := path.Match(glob, ref.Name())
+		return ok
+	}) {
+		breaks("allowed_repositories", "repository %v isn't allowed", ref.Name())
+	}
+
+	if p.RequireDigest && ref.Digest == "" {
+		breaks("require_digest", "images must be pinned to a digest, e.g., %v@sha256:...", ref.Name())
+	}
+
+	tag := ref.Tag
+	if tag == "" && ref.Digest == "" {
+		tag = "latest"
+	}
+	if tag != "" && slices.Contains(p.BannedTags, tag) {
+		breaks("banned_tags", "tag %q is banned", tag)
+	}
+
+	return broken
+}
+
+// checkImagePolicy checks the job's and services' images against the
+// runner's IMAGE_POLICY_FILE, if it has one. Violations fail the job,
+// unless the policy is audit only, when we just report them.
+func (cfg *JobConfig) checkImagePolicy() error {
+	p, err := loadImagePolicy(cfg.ImagePolicyFile)
+	if err != nil || p == nil {
+		return err
+	}
+
+	images := []*Image{&cfg.Image}
+	for _, s := range cfg.Services {
+		images = append(images, &s.Image)
+	}
+
+	var errs []error
+	for _, img := range images {
+		if img.Name == "" {
+			continue
+		}
+		ref, err := parseImageRef(img.Name)
+		if err != nil {
+			return err
+		}
+		for _, e := range p.check(ref) {
+			e.Image, e.Alias = img.Name, img.Alias
+			errs = append(errs, e)
+		}
+	}
+
+	if p.AuditOnly {
+		for _, e := range errs {
+			fmt.Printf("[cfd] Warning: %v (audit only)\n", e)
+		}
+		return nil
+	}
+	if len(errs) > 0 {
+		return &BuildFailureError{Err: errors.Join(errs...)}
+	}
+	return nil
+}
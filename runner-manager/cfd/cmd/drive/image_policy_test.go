@@ -0,0 +1,199 @@
+package drive
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestImagePolicy_check(t *testing.T) {
+	const digest = "sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+
+	tests := map[string]struct {
+		policy    *ImagePolicy
+		image     string
+		wantRules []string
+	}{
+		"allows anything without a policy": {
+			image: "ubuntu",
+		},
+		"allows listed registries": {
+			policy: &ImagePolicy{AllowedRegistries: []string{"docker.io", "ghcr.io"}},
+			image:  "ghcr.io/gsa-tts/foo:1",
+		},
+		"rejects other registries": {
+			policy:    &ImagePolicy{AllowedRegistries: []string{"docker.io"}},
+			image:     "quay.io/foo/bar:1",
+			wantRules: []string{"allowed_registries"},
+		},
+		"matches repository globs on the full name": {
+			policy: &ImagePolicy{AllowedRepositories: []string{"docker.io/library/*"}},
+			image:  "postgres:16",
+		},
+		"rejects repositories not matching a glob": {
+			policy:    &ImagePolicy{AllowedRepositories: []string{"docker.io/library/*"}},
+			image:     "bitnami/postgresql:16",
+			wantRules: []string{"allowed_repositories"},
+		},
+		"allows pinned images": {
+			policy: &ImagePolicy{RequireDigest: true},
+			image:  "postgres@" + digest,
+		},
+		"rejects unpinned images": {
+			policy:    &ImagePolicy{RequireDigest: true},
+			image:     "postgres:16",
+			wantRules: []string{"require_digest"},
+		},
+		"rejects banned tags": {
+			policy:    &ImagePolicy{BannedTags: []string{"latest"}},
+			image:     "postgres:latest",
+			wantRules: []string{"banned_tags"},
+		},
+		"treats no tag as latest": {
+			policy:    &ImagePolicy{BannedTags: []string{"latest"}},
+			image:     "postgres",
+			wantRules: []string{"banned_tags"},
+		},
+		"doesn't treat a digest as latest": {
+			policy: &ImagePolicy{BannedTags: []string{"latest"}},
+			image:  "postgres@" + digest,
+		},
+		"reports every broken rule": {
+			policy: &ImagePolicy{
+				AllowedRegistries: []string{"ghcr.io"},
+				RequireDigest:     true,
+				BannedTags:        []string{"latest"},
+			},
+			image:     "ubuntu",
+			wantRules: []string{"allowed_registries", "require_digest", "banned_tags"},
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			ref, err := parseImageRef(tt.image)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var rules []string
+			for _, e := range tt.policy.check(ref) {
+				rules = append(rules, e.Rule)
+			}
+			if diff := cmp.Diff(rules, tt.wantRules); diff != "" {
+				t.Errorf("mismatch (-got +want):\n%s", diff)
+			}
+		})
+	}
+}
+
+func Test_loadImagePolicy(t *testing.T) {
+	tests := map[string]struct {
+		file    string
+		want    *ImagePolicy
+		wantErr bool
+	}{
+		"loads YAML": {
+			file: "allowed_registries: [GHCR.io]\nbanned_tags: [latest]\naudit_only: true\n",
+			want: &ImagePolicy{
+				AllowedRegistries: []string{"ghcr.io"},
+				BannedTags:        []string{"latest"},
+				AuditOnly:         true,
+			},
+		},
+		"loads JSON": {
+			file: `{"allowed_repositories": ["docker.io/library/*"], "require_digest": true}`,
+			want: &ImagePolicy{
+				AllowedRepositories: []string{"docker.io/library/*"},
+				RequireDigest:       true,
+			},
+		},
+		"loads empty files":          {file: "", want: &ImagePolicy{}},
+		"fails with malformed files": {file: "allowed_registries: [", wantErr: true},
+		"fails with unknown keys":    {file: "allowed_registry: [ghcr.io]\n", wantErr: true},
+		"fails with unknown JSON keys": {
+			file:    `{"require_digests": true}`,
+			wantErr: true,
+		},
+		"fails with bad globs": {file: `allowed_repositories: ["docker.io/["]`, wantErr: true},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "policy")
+			if err := os.WriteFile(file, []byte(tt.file), 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := loadImagePolicy(file)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("loadImagePolicy() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if diff := cmp.Diff(got, tt.want); diff != "" {
+				t.Errorf("mismatch (-got +want):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestJobConfig_checkImagePolicy(t *testing.T) {
+	writePolicy := func(t *testing.T, policy string) string {
+		file := filepath.Join(t.TempDir(), "policy.yml")
+		if err := os.WriteFile(file, []byte(policy), 0600); err != nil {
+			t.Fatal(err)
+		}
+		return file
+	}
+	job := JobResponse{
+		Image:    Image{Name: "ubuntu:jammy"},
+		Services: []*Service{{Image: Image{Name: "postgres", Alias: "db"}}},
+	}
+
+	t.Run("passes without a policy", func(t *testing.T) {
+		cfg := &JobConfig{JobResponse: job}
+		if err := cfg.checkImagePolicy(); err != nil {
+			t.Errorf("checkImagePolicy() error = %v", err)
+		}
+	})
+
+	t.Run("fails the build naming the rule", func(t *testing.T) {
+		cfg := &JobConfig{JobResponse: job, ImagePolicyFile: writePolicy(t, "banned_tags: [latest]")}
+
+		err := cfg.checkImagePolicy()
+		var buildErr *BuildFailureError
+		if !errors.As(err, &buildErr) {
+			t.Fatalf("checkImagePolicy() error = %v, want a BuildFailureError", err)
+		}
+		want := `service db image "postgres" violates image policy rule banned_tags: tag "latest" is banned`
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("checkImagePolicy() error = %v, want it to contain %q", err, want)
+		}
+		if strings.Contains(err.Error(), "ubuntu") {
+			t.Errorf("checkImagePolicy() error = %v, want only the service's image", err)
+		}
+		if hint := FailureHint(err); !strings.Contains(hint, "image policy") {
+			t.Errorf("FailureHint() = %q, want it to mention the image policy", hint)
+		}
+	})
+
+	t.Run("only reports in audit mode", func(t *testing.T) {
+		cfg := &JobConfig{
+			JobResponse:     job,
+			ImagePolicyFile: writePolicy(t, "banned_tags: [latest]\naudit_only: true"),
+		}
+		if err := cfg.checkImagePolicy(); err != nil {
+			t.Errorf("checkImagePolicy() error = %v", err)
+		}
+	})
+
+	t.Run("fails if the policy is missing", func(t *testing.T) {
+		cfg := &JobConfig{JobResponse: job, ImagePolicyFile: filepath.Join(t.TempDir(), "nope")}
+		if err := cfg.checkImagePolicy(); err == nil {
+			t.Error("checkImagePolicy() succeeded without its policy file")
+		}
+	})
+}
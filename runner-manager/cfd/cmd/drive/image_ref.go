@@ -0,0 +1,106 @@
+package drive
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// ImageRef is a parsed docker image reference, e.g.,
+// "ghcr.io/gsa-tts/foo:1.2@sha256:...". Docker Hub short names are
+// filled out, so "ubuntu" is Registry "docker.io", Repository
+// "library/ubuntu".
+type ImageRef struct {
+	Registry   string // normalized host[:port]
+	Repository string // path within the registry
+	Tag        string // empty if not given
+	Digest     string // e.g., "sha256:<hex>", empty if not given
+}
+
+// Following github.com/distribution/reference's grammar
+var (
+	imageDomainRegex = regexp.MustCompile(
+		`^(?:(?:[a-zA-Z0-9]|[a-zA-Z0-9][a-zA-Z0-9-]*[a-zA-Z0-9])(?:\.(?:[a-zA-Z0-9]|[a-zA-Z0-9][a-zA-Z0-9-]*[a-zA-Z0-9]))*|\[[a-fA-F0-9:]+\])(?::[0-9]+)?$`,
+	)
+	imagePathRegex   = regexp.MustCompile(`^[a-z0-9]+(?:(?:[._]|__|-+)[a-z0-9]+)*(?:/[a-z0-9]+(?:(?:[._]|__|-+)[a-z0-9]+)*)*$`)
+	imageTagRegex    = regexp.MustCompile(`^[\w][\w.-]{0,127}$`)
+	imageDigestRegex = regexp.MustCompile(`^[a-z0-9]+(?:[.+_-][a-z0-9]+)*:[a-zA-Z0-9=_-]{32,}$`)
+)
+
+const imageNameMaxLength = 255
+
+var errEmptyImageRef = errors.New("empty image reference")
+
+// parseImageRef splits an image reference into its parts like docker
+// does: the first path component is only a registry if it has a "." or
+// ":", is "localhost", or has upper case letters, otherwise the image is
+// on Docker Hub.
+func parseImageRef(s string) (ref *ImageRef, err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("error parsing image %q: %w", s, err)
+		}
+	}()
+
+	if s == "" {
+		return nil, errEmptyImageRef
+	}
+
+	ref = &ImageRef{}
+	name := s
+
+	if i := strings.Index(name, "@"); i >= 0 {
+		name, ref.Digest = name[:i], name[i+1:]
+		if !imageDigestRegex.MatchString(ref.Digest) {
+			return nil, fmt.Errorf("invalid digest %q", ref.Digest)
+		}
+	}
+
+	// a ":" after the last "/" starts the tag, others are a registry port
+	if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		name, ref.Tag = name[:i], name[i+1:]
+		if !imageTagRegex.MatchString(ref.Tag) {
+			return nil, fmt.Errorf("invalid tag %q", ref.Tag)
+		}
+	}
+
+	if len(name) > imageNameMaxLength {
+		return nil, fmt.Errorf("name longer than %d characters", imageNameMaxLength)
+	}
+
+	first, rest, ok := strings.Cut(name, "/")
+	if ok && (strings.ContainsAny(first, ".:") || first == "localhost" || strings.ToLower(first) != first) {
+		if !imageDomainRegex.MatchString(first) {
+			return nil, fmt.Errorf("invalid registry %q", first)
+		}
+		ref.Registry, ref.Repository = normalizeRegistryHost(first), rest
+	} else {
+		ref.Registry, ref.Repository = dockerHubHost, name
+	}
+
+	if ref.Registry == dockerHubHost && !strings.Contains(ref.Repository, "/") {
+		ref.Repository = "library/" + ref.Repository
+	}
+
+	if !imagePathRegex.MatchString(ref.Repository) {
+		return nil, fmt.Errorf("invalid repository %q", ref.Repository)
+	}
+	return ref, nil
+}
+
+// Name is the fully qualified repository, e.g., "docker.io/library/ubuntu".
+func (r *ImageRef) Name() string {
+	return r.Registry + "/" + r.Repository
+}
+
+func (r *ImageRef) String() string {
+	s := r.Name()
+	if r.Tag != "" {
+		s += ":" + r.Tag
+	}
+	if r.Digest != "" {
+		s += "@" + r.Digest
+	}
+	return s
+}
@@ -0,0 +1,86 @@
+package drive
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func Test_parseImageRef(t *testing.T) {
+	const digest = "sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+
+	tests := map[string]struct {
+		want    *ImageRef
+		wantStr string
+		wantErr bool
+	}{
+		"ubuntu": {
+			want:    &ImageRef{Registry: "docker.io", Repository: "library/ubuntu"},
+			wantStr: "docker.io/library/ubuntu",
+		},
+		"ubuntu:jammy": {
+			want: &ImageRef{Registry: "docker.io", Repository: "library/ubuntu", Tag: "jammy"},
+		},
+		"bitnami/postgresql:16": {
+			want: &ImageRef{Registry: "docker.io", Repository: "bitnami/postgresql", Tag: "16"},
+		},
+		"index.docker.io/library/ubuntu": {
+			want: &ImageRef{Registry: "docker.io", Repository: "library/ubuntu"},
+		},
+		"docker.io/ubuntu": {
+			want: &ImageRef{Registry: "docker.io", Repository: "library/ubuntu"},
+		},
+		"ghcr.io/gsa-tts/foo/bar:1.2.3": {
+			want: &ImageRef{Registry: "ghcr.io", Repository: "gsa-tts/foo/bar", Tag: "1.2.3"},
+		},
+		"localhost:5000/img": {
+			want: &ImageRef{Registry: "localhost:5000", Repository: "img"},
+		},
+		"localhost/img:v1": {
+			want: &ImageRef{Registry: "localhost", Repository: "img", Tag: "v1"},
+		},
+		"gitlab.example.com:5050/group/proj:main": {
+			want: &ImageRef{Registry: "gitlab.example.com:5050", Repository: "group/proj", Tag: "main"},
+		},
+		"Registry/img": {
+			want: &ImageRef{Registry: "registry", Repository: "img"},
+		},
+		"[::1]:5000/img": {
+			want: &ImageRef{Registry: "[::1]:5000", Repository: "img"},
+		},
+		"postgres@" + digest: {
+			want:    &ImageRef{Registry: "docker.io", Repository: "library/postgres", Digest: digest},
+			wantStr: "docker.io/library/postgres@" + digest,
+		},
+		"localhost:5000/img:v1@" + digest: {
+			want:    &ImageRef{Registry: "localhost:5000", Repository: "img", Tag: "v1", Digest: digest},
+			wantStr: "localhost:5000/img:v1@" + digest,
+		},
+		"":                           {wantErr: true},
+		"Ubuntu":                     {wantErr: true},
+		"ubuntu:":                    {wantErr: true},
+		"ubuntu:-bad":                {wantErr: true},
+		"ubuntu@sha256:short":        {wantErr: true},
+		"ubuntu@" + digest + ":more": {wantErr: true},
+		"bad_host.com:port/img":      {wantErr: true},
+		"foo//bar":                   {wantErr: true},
+		"foo/bar/":                   {wantErr: true},
+		strings.Repeat("a", 256):     {wantErr: true},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := parseImageRef(name)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseImageRef() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if diff := cmp.Diff(got, tt.want); diff != "" {
+				t.Errorf("mismatch (-got +want):\n%s", diff)
+			}
+			if got != nil && tt.wantStr != "" && got.String() != tt.wantStr {
+				t.Errorf("String() = %v, want %v", got.String(), tt.wantStr)
+			}
+		})
+	}
+}
@@ -1,9 +1,19 @@
 package drive
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/GSA-TTS/gitlab-runner-cloudgov/runner-manager/cfd/cloudgov"
 	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh"
 )
 
 var prepareCmd = &cobra.Command{
@@ -33,66 +43,396 @@ https://docs.gitlab.com/runner/executors/custom.html#prepare`,
 
 type prepStage commonStage
 
+const (
+	// Service variable listing ports to open, e.g., "5432" or "80,8000-8010"
+	servicePortsVar             = "SERVICE_PORTS"
+	servicePortsFallbackDefault = "20-10000"
+
+	proxyPortHTTP  = "8080"
+	proxyPortHTTPS = "61443"
+
+	serviceStartTimeoutDefault = 5 * time.Minute
+	workerStartTimeout         = 5 * time.Minute
+)
+
 func run(cmd *cobra.Command, args []string) error {
-	s, err := newStage(nil)
+	s, err := newStage(cmd.Context(), nil)
 	if err != nil {
-		return fmt.Errorf("error initializing prepare stage: %w", err)
+		return &SystemFailureError{fmt.Errorf("error initializing prepare stage: %w", err)}
 	}
 
-	err = s.prep.exec()
+	ctx, cancel, err := stageContext(
+		cmd.Context(), "PREPARE_TIMEOUT", s.common.config.PrepareTimeout, prepareTimeoutDefault,
+	)
 	if err != nil {
-		return fmt.Errorf("error executing prepare stage: %w", err)
+		return &SystemFailureError{fmt.Errorf("error initializing prepare stage: %w", err)}
+	}
+	defer cancel()
+
+	err = s.prep.exec(ctx)
+	if err != nil {
+		return stageFailure(fmt.Errorf("error executing prepare stage: %w", err))
 	}
 
 	return nil
 }
 
-func (s *prepStage) exec() (err error) {
+func (s *prepStage) exec(ctx context.Context) (err error) {
+	for _, w := range s.config.Warnings {
+		fmt.Printf("[cfd] Warning: %v\n", w)
+	}
+
+	// Before we push anything
+	err = s.config.checkImagePolicy()
+	if err != nil {
+		return err
+	}
+
+	err = s.deleteStaleApps(ctx)
+	if err != nil {
+		return err
+	}
+
 	// Looping service manifests to run `cf push`
-	err = s.startServices()
+	err = s.startServices(ctx)
 	if err != nil {
 		return err
 	}
 
 	// Pushing the main job config pulled from get_job_config.go
-	_, err = s.client.Push(s.config.Manifest)
+	worker, err := s.client.Push(ctx, s.config.Manifest)
+	if err != nil {
+		(*commonStage)(s).printFailureLogs(ctx, "worker", s.config.Manifest, nil)
+		return err
+	}
+
+	// SSH needs a running instance, and one that crashes should say why
+	err = s.waitForWorker(ctx, worker)
 	if err != nil {
+		(*commonStage)(s).printFailureLogs(ctx, "worker", s.config.Manifest, worker)
 		return err
 	}
 
-	err = s.installDeps()
+	// This must come before any SSH steps, as adding policies can restart
+	// the container and wipe out changes made over SSH.
+	err = s.setupProxyAccess(ctx, worker)
 	if err != nil {
 		return err
 	}
 
-	return s.setNetworkPolicies()
+	err = s.installDeps(ctx, worker)
+	if err != nil {
+		return err
+	}
+
+	return s.setNetworkPolicies(ctx, worker)
+}
+
+// deleteStaleApps deletes any of the job's apps left over from an
+// earlier attempt at it, e.g., one whose cleanup never ran, so we don't
+// push over them.
+func (s *prepStage) deleteStaleApps(ctx context.Context) error {
+	common := (*commonStage)(s)
+
+	apps, err := common.jobApps(ctx)
+	if err != nil {
+		return fmt.Errorf("error checking for old instances: %w", err)
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(apps)) {
+		fmt.Printf("[cfd] Found old instance of %v, deleting\n", name)
+		if err = common.deleteApp(ctx, name, apps[name]); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-// TODO: refactor to include a service manifests slice and
-// use client.ServicesPush or get rid of it
-func (s *prepStage) startServices() error {
-	if len(s.config.Services) < 1 {
+// startServices pushes every service at once, maps their internal
+// routes, and waits for them all to become healthy.
+func (s *prepStage) startServices(ctx context.Context) (err error) {
+	services := s.config.Services
+	if len(services) < 1 {
 		return nil
 	}
 
-	for _, serv := range s.config.Services {
-		s.client.Push(serv.Manifest)
-		// map-route containerID apps.internal --hostname containerID
+	timeout, err := s.config.serviceStartTimeout()
+	if err != nil {
+		return err
+	}
+	limit, err := s.config.servicePushLimit()
+	if err != nil {
+		return err
+	}
+
+	manifests := make([]*cloudgov.AppManifest, len(services))
+	for i, serv := range services {
+		fmt.Printf("[cfd] Starting service %v\n", serv.Alias)
+		manifests[i] = serv.Manifest
+	}
+
+	since := time.Now()
+	apps, err := s.client.ServicesPush(ctx, manifests, limit)
+	for i, serv := range services {
+		serv.App = apps[i]
+	}
+	if err != nil {
+		for _, serv := range services {
+			if serv.App == nil {
+				(*commonStage)(s).printFailureLogs(ctx, serv.Alias, serv.Manifest, nil)
+			}
+		}
+		return fmt.Errorf("error pushing services: %w", err)
+	}
+
+	stop := (*commonStage)(s).streamServiceLogs(ctx, since)
+	defer stop()
+
+	for _, serv := range services {
+		if serv.App == nil {
+			return fmt.Errorf("error pushing service %v: no app returned", serv.Alias)
+		}
 
-		// TODO: implement WSR_ vars
-		// Leaving this until more is implemented so the form can fit function
-		// export WSR_SERVICE_HOST_$alias=$containerID.apps.internal
+		// <serviceID>.apps.internal, see WSR_SERVICE_HOST_<alias>
+		if err = s.client.MapServiceRoute(ctx, serv.App); err != nil {
+			return fmt.Errorf("error mapping route for service %v: %w", serv.Alias, err)
+		}
 	}
 
+	// Services boot alongside each other, so they share one deadline
+	deadline := time.Now().Add(timeout)
+	for _, serv := range services {
+		if err = s.waitForService(ctx, serv, deadline); err != nil {
+			(*commonStage)(s).printFailureLogs(ctx, serv.Alias, serv.Manifest, serv.App)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// waitForService waits for serv's instances to be RUNNING, i.e., their
+// health checks pass, so jobs don't start against a service that's
+// still booting.
+func (s *prepStage) waitForService(ctx context.Context, serv *Service, deadline time.Time) error {
+	fmt.Printf("[cfd] Waiting for service %v to become healthy\n", serv.Alias)
+
+	if err := s.client.WaitForState(ctx, serv.App, "RUNNING", deadline); err != nil {
+		return fmt.Errorf("service %v didn't become healthy: %w", serv.Alias, err)
+	}
 	return nil
 }
 
-// TODO: implement
-func (s *prepStage) installDeps() error {
-	panic("unimplemented")
+// waitForWorker waits for the worker's instance to be RUNNING, as Push
+// returns once CF is starting it.
+func (s *prepStage) waitForWorker(ctx context.Context, worker *cloudgov.App) error {
+	fmt.Println("[cfd] Waiting for worker to start")
+
+	deadline := time.Now().Add(workerStartTimeout)
+	if err := s.client.WaitForState(ctx, worker, "RUNNING", deadline); err != nil {
+		return fmt.Errorf("worker didn't start: %w", err)
+	}
+	return nil
+}
+
+// servicePushLimit is how many services we push at once, 0 for the
+// client's default.
+func (cfg *JobConfig) servicePushLimit() (int, error) {
+	if cfg.ServicePushConcurrency == "" {
+		return 0, nil
+	}
+
+	n, err := strconv.Atoi(cfg.ServicePushConcurrency)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("invalid SERVICE_PUSH_CONCURRENCY %q, want a positive number", cfg.ServicePushConcurrency)
+	}
+	return n, nil
 }
 
-// TODO: implement
-func (s *prepStage) setNetworkPolicies() error {
-	panic("unimplemented")
+// serviceStartTimeout is how long to wait for services to become healthy.
+func (cfg *JobConfig) serviceStartTimeout() (time.Duration, error) {
+	return parseTimeout("SERVICE_START_TIMEOUT", cfg.ServiceStartTimeout, serviceStartTimeoutDefault)
+}
+
+// setupProxyAccess opens the egress proxy's ports to the worker
+// according to WORKER_PROXY_MODE.
+func (s *prepStage) setupProxyAccess(ctx context.Context, worker *cloudgov.App) (err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("error setting up egress proxy access: %w", err)
+		}
+	}()
+
+	if s.config.ProxyAppName == "" {
+		return nil
+	}
+
+	ports, err := proxyPorts(s.config.WorkerProxyMode)
+	if err != nil {
+		return err
+	}
+
+	space := s.config.ProxySpace
+	if space == "" {
+		space = s.config.SpaceName
+	}
+
+	proxy, err := s.client.AppFind(ctx, s.config.OrgName, space, s.config.ProxyAppName)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("[cfd] Setting up egress proxy access for %v\n", worker.Name)
+	return s.client.AddNetworkPolicy(ctx, worker, proxy, ports)
+}
+
+func proxyPorts(mode string) ([]string, error) {
+	switch mode {
+	case "http":
+		return []string{proxyPortHTTP}, nil
+	case "https":
+		return []string{proxyPortHTTPS}, nil
+	case "both", "":
+		return []string{proxyPortHTTPS, proxyPortHTTP}, nil
+	}
+	return nil, fmt.Errorf("unknown WORKER_PROXY_MODE %q, want http, https, or both", mode)
+}
+
+// installDeps copies the worker-setup bundle to the worker and runs it,
+// giving jobs git, git-lfs, CA certs, etc. whatever their image.
+func (s *prepStage) installDeps(ctx context.Context, worker *cloudgov.App) (err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("error installing dependencies on %v: %w", worker.Name, err)
+		}
+	}()
+
+	bundleDir := s.config.bundleDir()
+
+	fmt.Println("[cfd] Checking for certs in bundle")
+	if err = ensureCertsBundle(bundleDir, caCertsDir); err != nil {
+		return err
+	}
+
+	fmt.Println("[cfd] Copying bundle to worker")
+	if err = s.stage.CopySSH(ctx, worker.GUID, bundleDir, "."); err != nil {
+		return err
+	}
+
+	fmt.Println("[cfd] Running worker setup")
+	err = s.stage.RunSSH(ctx, worker.GUID, "./bundle/glrw-setup.sh", nil)
+
+	var exitErr *ssh.ExitError
+	if errors.As(err, &exitErr) {
+		return fmt.Errorf("glrw-setup.sh exited with code %d", exitErr.ExitStatus())
+	}
+	return err
+}
+
+// setNetworkPolicies lets the worker reach each service, and services
+// reach each other, but only on the ports each service listens on.
+func (s *prepStage) setNetworkPolicies(ctx context.Context, worker *cloudgov.App) (err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("error setting network policies: %w", err)
+		}
+	}()
+
+	services := s.config.Services
+	if len(services) < 1 {
+		return nil
+	}
+
+	ports := make(map[*Service][]string, len(services))
+	for _, serv := range services {
+		if serv.App == nil {
+			return fmt.Errorf("service %v has no app to open ports on", serv.Alias)
+		}
+		if ports[serv], err = s.servicePorts(ctx, serv); err != nil {
+			return err
+		}
+	}
+
+	for _, to := range services {
+		fmt.Printf(
+			"[cfd] Allowing access to service %v on ports %v\n",
+			to.Alias, strings.Join(ports[to], ","),
+		)
+
+		if err = s.client.AddNetworkPolicy(ctx, worker, to.App, ports[to]); err != nil {
+			return err
+		}
+
+		for _, from := range services {
+			if from == to {
+				continue
+			}
+			if err = s.client.AddNetworkPolicy(ctx, from.App, to.App, ports[to]); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// servicePorts picks the ports to open on a service: those set in its
+// SERVICE_PORTS variable, else those its image EXPOSEs, else a fallback.
+func (s *prepStage) servicePorts(ctx context.Context, serv *Service) ([]string, error) {
+	if v, ok := ciVar(serv.Variables, servicePortsVar); ok {
+		return parsePortList(v)
+	}
+
+	exposed, err := s.client.AppExposedPorts(ctx, serv.App)
+	if err != nil {
+		return nil, fmt.Errorf("error getting ports for service %v: %w", serv.Alias, err)
+	}
+	if len(exposed) > 0 {
+		ports := make([]string, len(exposed))
+		for i, p := range exposed {
+			ports[i] = strconv.Itoa(p)
+		}
+		return ports, nil
+	}
+
+	fallback := s.config.ServicePortsFallback
+	if fallback == "" {
+		fallback = servicePortsFallbackDefault
+	}
+	fmt.Printf(
+		"[cfd] WARNING: service %v declares no ports, falling back to %v. Set %v to narrow this.\n",
+		serv.Alias, fallback, servicePortsVar,
+	)
+	return parsePortList(fallback)
+}
+
+var portRangeRegex = regexp.MustCompile(`^(\d+)(?:-(\d+))?$`)
+
+// parsePortList splits a list like "80, 443 8000-8010" into port ranges
+// AddNetworkPolicy understands, checking each is a sane range.
+func parsePortList(list string) ([]string, error) {
+	fields := strings.FieldsFunc(list, func(r rune) bool {
+		return r == ',' || r == ' '
+	})
+	if len(fields) < 1 {
+		return nil, fmt.Errorf("no ports in %q", list)
+	}
+
+	for _, f := range fields {
+		m := portRangeRegex.FindStringSubmatch(f)
+		if m == nil {
+			return nil, fmt.Errorf("malformed port range %q", f)
+		}
+
+		start, _ := strconv.Atoi(m[1])
+		end := start
+		if m[2] != "" {
+			end, _ = strconv.Atoi(m[2])
+		}
+		if start < 1 || end > 65535 || start > end {
+			return nil, fmt.Errorf("port range %q out of bounds", f)
+		}
+	}
+
+	return fields, nil
 }
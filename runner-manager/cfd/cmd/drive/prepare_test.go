@@ -0,0 +1,117 @@
+package drive
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func Test_parsePortList(t *testing.T) {
+	tests := map[string]struct {
+		list    string
+		want    []string
+		wantErr bool
+	}{
+		"parses a single port":        {list: "5432", want: []string{"5432"}},
+		"parses a range":              {list: "8000-8010", want: []string{"8000-8010"}},
+		"parses a mixed list":         {list: "80, 443 8000-8010", want: []string{"80", "443", "8000-8010"}},
+		"fails with an empty list":    {list: " , ", wantErr: true},
+		"fails with a non-port":       {list: "80,http", wantErr: true},
+		"fails with a reversed range": {list: "90-80", wantErr: true},
+		"fails with port zero":        {list: "0", wantErr: true},
+		"fails with too high a port":  {list: "1-65536", wantErr: true},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := parsePortList(tt.list)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parsePortList() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if diff := cmp.Diff(got, tt.want); diff != "" {
+				t.Errorf("mismatch (-got +want):\n%s", diff)
+			}
+		})
+	}
+}
+
+func Test_proxyPorts(t *testing.T) {
+	tests := map[string]struct {
+		mode    string
+		want    []string
+		wantErr bool
+	}{
+		"opens http":              {mode: "http", want: []string{"8080"}},
+		"opens https":             {mode: "https", want: []string{"61443"}},
+		"opens both":              {mode: "both", want: []string{"61443", "8080"}},
+		"opens both by default":   {want: []string{"61443", "8080"}},
+		"fails with unknown mode": {mode: "socks", wantErr: true},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := proxyPorts(tt.mode)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("proxyPorts() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if diff := cmp.Diff(got, tt.want); diff != "" {
+				t.Errorf("mismatch (-got +want):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestJobConfig_serviceStartTimeout(t *testing.T) {
+	tests := map[string]struct {
+		timeout string
+		want    time.Duration
+		wantErr bool
+	}{
+		"defaults to five minutes":  {want: 5 * time.Minute},
+		"parses seconds":            {timeout: "90", want: 90 * time.Second},
+		"parses a duration":         {timeout: "2m30s", want: 150 * time.Second},
+		"fails with garbage":        {timeout: "soon", wantErr: true},
+		"fails with a zero timeout": {timeout: "0", wantErr: true},
+		"fails with a negative one": {timeout: "-1m", wantErr: true},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			cfg := &JobConfig{ServiceStartTimeout: tt.timeout}
+			got, err := cfg.serviceStartTimeout()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("serviceStartTimeout() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("serviceStartTimeout() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestJobConfig_servicePushLimit(t *testing.T) {
+	tests := map[string]struct {
+		limit   string
+		want    int
+		wantErr bool
+	}{
+		"leaves the default to the client": {},
+		"parses a limit":                   {limit: "3", want: 3},
+		"fails with garbage":               {limit: "lots", wantErr: true},
+		"fails with zero":                  {limit: "0", wantErr: true},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			cfg := &JobConfig{ServicePushConcurrency: tt.limit}
+			got, err := cfg.servicePushLimit()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("servicePushLimit() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("servicePushLimit() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
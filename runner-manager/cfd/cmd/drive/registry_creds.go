@@ -0,0 +1,159 @@
+package drive
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+const dockerHubHost = "docker.io"
+
+// RegistryCreds are what CF needs to pull an image from a private registry.
+type RegistryCreds struct {
+	Username string
+	Password string
+}
+
+// CredsResolver finds credentials for a registry host, as in ImageRef.
+// If none do, we pull anonymously.
+type CredsResolver interface {
+	Resolve(host string) (RegistryCreds, bool)
+}
+
+// credsChain asks each resolver in turn, the first with creds wins.
+type credsChain []CredsResolver
+
+func (c credsChain) Resolve(host string) (RegistryCreds, bool) {
+	for _, r := range c {
+		if r == nil {
+			continue
+		}
+		if creds, ok := r.Resolve(host); ok {
+			return creds, true
+		}
+	}
+	return RegistryCreds{}, false
+}
+
+// hostCreds are creds for a single registry, e.g., from runner settings.
+type hostCreds struct {
+	host  string
+	creds RegistryCreds
+}
+
+func newHostCreds(host string, username string, password string) *hostCreds {
+	if host == "" || username == "" || password == "" {
+		return nil
+	}
+	return &hostCreds{
+		host:  normalizeRegistryHost(host),
+		creds: RegistryCreds{Username: username, Password: password},
+	}
+}
+
+func (h *hostCreds) Resolve(host string) (RegistryCreds, bool) {
+	if h == nil || h.host != host {
+		return RegistryCreds{}, false
+	}
+	return h.creds, true
+}
+
+// dockerAuthConfig holds the "auths" of a docker config.json, keyed by
+// normalized host. Credential helpers and stores aren't supported.
+type dockerAuthConfig map[string]RegistryCreds
+
+func (d dockerAuthConfig) Resolve(host string) (RegistryCreds, bool) {
+	creds, ok := d[host]
+	return creds, ok
+}
+
+// parseDockerAuthConfig reads a DOCKER_AUTH_CONFIG, e.g.,
+//
+//	{"auths": {"ghcr.io": {"auth": "<base64 of user:pass>"}}}
+//
+// Entries may instead have "username" and "password".
+func parseDockerAuthConfig(j string) (_ dockerAuthConfig, err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("error parsing DOCKER_AUTH_CONFIG: %w", err)
+		}
+	}()
+
+	if j == "" {
+		return nil, nil
+	}
+
+	var raw struct {
+		Auths map[string]struct {
+			Auth     string `json:"auth"`
+			Username string `json:"username"`
+			Password string `json:"password"`
+		} `json:"auths"`
+	}
+	if err = json.Unmarshal([]byte(j), &raw); err != nil {
+		return nil, err
+	}
+
+	d := make(dockerAuthConfig, len(raw.Auths))
+	for host, a := range raw.Auths {
+		creds := RegistryCreds{Username: a.Username, Password: a.Password}
+		if a.Auth != "" {
+			b, err := base64.StdEncoding.DecodeString(a.Auth)
+			if err != nil {
+				return nil, fmt.Errorf("auth for %v: %w", host, err)
+			}
+			user, pass, ok := strings.Cut(string(b), ":")
+			if !ok {
+				return nil, fmt.Errorf("auth for %v isn't user:password", host)
+			}
+			creds = RegistryCreds{Username: user, Password: pass}
+		}
+		if creds.Username == "" {
+			continue
+		}
+		d[normalizeRegistryHost(host)] = creds
+	}
+	return d, nil
+}
+
+// normalizeRegistryHost makes the ways of writing a registry in auth
+// configs, CI variables, and images comparable, e.g.,
+// "https://index.docker.io/v1/" -> "docker.io", "GHCR.io" -> "ghcr.io".
+func normalizeRegistryHost(host string) string {
+	host = strings.ToLower(strings.TrimSpace(host))
+	host = strings.TrimPrefix(host, "https://")
+	host = strings.TrimPrefix(host, "http://")
+	host, _, _ = strings.Cut(host, "/")
+
+	switch host {
+	case "index.docker.io", "registry-1.docker.io", "registry.hub.docker.com":
+		return dockerHubHost
+	}
+	return host
+}
+
+// credsResolver is how we find creds for this job's images: the job's
+// DOCKER_AUTH_CONFIG, then the runner's, then the job's CI registry
+// token, then the runner's Docker Hub account.
+func (cfg *JobConfig) credsResolver() (CredsResolver, error) {
+	jobAuth := cfg.JobDockerAuthConfig
+	if v, ok := ciVar(cfg.Variables, "DOCKER_AUTH_CONFIG"); ok {
+		jobAuth = v
+	}
+	jobAuths, err := parseDockerAuthConfig(jobAuth)
+	if err != nil {
+		return nil, err
+	}
+	runnerAuths, err := parseDockerAuthConfig(cfg.DockerAuthConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	return credsChain{
+		jobAuths,
+		runnerAuths,
+		newHostCreds(cfg.CIRegistry, cfg.CIRegistryUser, cfg.CIRegistryPass),
+		newHostCreds(dockerHubHost, cfg.DockerHubUser, cfg.DockerHubToken),
+	}, nil
+}
@@ -0,0 +1,161 @@
+package drive
+
+import (
+	"testing"
+
+	"github.com/GSA-TTS/gitlab-runner-cloudgov/runner-manager/cfd/cloudgov"
+	"github.com/google/go-cmp/cmp"
+)
+
+func Test_normalizeRegistryHost(t *testing.T) {
+	tests := map[string]string{
+		"https://index.docker.io/v1/": "docker.io",
+		"registry.hub.docker.com":     "docker.io",
+		"https://GHCR.io":             "ghcr.io",
+		"http://localhost:5000/":      "localhost:5000",
+		" registry.gitlab.com ":       "registry.gitlab.com",
+	}
+	for host, want := range tests {
+		t.Run(host, func(t *testing.T) {
+			if got := normalizeRegistryHost(host); got != want {
+				t.Errorf("normalizeRegistryHost() = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func Test_parseDockerAuthConfig(t *testing.T) {
+	tests := map[string]struct {
+		json    string
+		want    dockerAuthConfig
+		wantErr bool
+	}{
+		"parses nothing": {},
+		"parses base64 auth": {
+			// "user:pa:ss", passwords can have colons
+			json: `{"auths":{"https://index.docker.io/v1/":{"auth":"dXNlcjpwYTpzcw=="}}}`,
+			want: dockerAuthConfig{"docker.io": {Username: "user", Password: "pa:ss"}},
+		},
+		"parses username and password": {
+			json: `{"auths":{"ghcr.io":{"username":"u","password":"p"}},"credsStore":"desktop"}`,
+			want: dockerAuthConfig{"ghcr.io": {Username: "u", Password: "p"}},
+		},
+		"skips entries without creds": {
+			json: `{"auths":{"ghcr.io":{}}}`,
+			want: dockerAuthConfig{},
+		},
+		"fails with malformed json":   {json: `{"auths":`, wantErr: true},
+		"fails with malformed base64": {json: `{"auths":{"ghcr.io":{"auth":"!!"}}}`, wantErr: true},
+		"fails without a colon":       {json: `{"auths":{"ghcr.io":{"auth":"dXNlcg=="}}}`, wantErr: true},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := parseDockerAuthConfig(tt.json)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseDockerAuthConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if diff := cmp.Diff(got, tt.want); diff != "" {
+				t.Errorf("mismatch (-got +want):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestJobConfig_credsResolver(t *testing.T) {
+	runner := JobConfig{
+		CIRegistry:       "gitlab.example.com:5050",
+		CIRegistryUser:   "gitlab-ci-token",
+		CIRegistryPass:   "job-token",
+		DockerHubUser:    "hub-user",
+		DockerHubToken:   "hub-token",
+		DockerAuthConfig: `{"auths":{"ghcr.io":{"username":"runner","password":"runner-pass"}}}`,
+	}
+	jobAuth := `{"auths":{"ghcr.io":{"username":"job","password":"job-pass"}}}`
+
+	tests := map[string]struct {
+		cfg   JobConfig
+		image string
+		want  cloudgov.AppManifestDocker
+	}{
+		"uses the CI registry's token": {
+			cfg:   runner,
+			image: "gitlab.example.com:5050/group/proj:latest",
+			want:  cloudgov.AppManifestDocker{Username: "gitlab-ci-token", Password: "job-token"},
+		},
+		"uses Docker Hub creds for official images": {
+			cfg:   runner,
+			image: "postgres:16",
+			want:  cloudgov.AppManifestDocker{Username: "hub-user", Password: "hub-token"},
+		},
+		"uses the runner's DOCKER_AUTH_CONFIG": {
+			cfg:   runner,
+			image: "ghcr.io/gsa-tts/foo",
+			want:  cloudgov.AppManifestDocker{Username: "runner", Password: "runner-pass"},
+		},
+		"prefers the job's DOCKER_AUTH_CONFIG": {
+			cfg: func() JobConfig {
+				cfg := runner
+				cfg.JobDockerAuthConfig = jobAuth
+				return cfg
+			}(),
+			image: "ghcr.io/gsa-tts/foo",
+			want:  cloudgov.AppManifestDocker{Username: "job", Password: "job-pass"},
+		},
+		"reads DOCKER_AUTH_CONFIG from job variables": {
+			cfg: func() JobConfig {
+				cfg := runner
+				cfg.Variables = []CIVar{{Key: "DOCKER_AUTH_CONFIG", Value: jobAuth}}
+				return cfg
+			}(),
+			image: "ghcr.io/gsa-tts/foo",
+			want:  cloudgov.AppManifestDocker{Username: "job", Password: "job-pass"},
+		},
+		"doesn't hard-code GitLab's registry": {
+			cfg:   runner,
+			image: "registry.gitlab.com/group/proj",
+		},
+		"pulls anonymously from other registries": {
+			cfg:   runner,
+			image: "quay.io/foo/bar",
+		},
+		"pulls anonymously without creds": {
+			image: "postgres:16",
+		},
+		"matches registries with ports": {
+			cfg: func() JobConfig {
+				cfg := runner
+				cfg.CIRegistry = "localhost:5000"
+				return cfg
+			}(),
+			image: "localhost:5000/img@sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef",
+			want:  cloudgov.AppManifestDocker{Username: "gitlab-ci-token", Password: "job-token"},
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			creds, err := tt.cfg.credsResolver()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			m := &cloudgov.AppManifest{}
+			if err = tt.cfg.processImage(Image{Name: tt.image}, m, creds); err != nil {
+				t.Fatal(err)
+			}
+
+			tt.want.Image = tt.image
+			if diff := cmp.Diff(m.Docker, tt.want); diff != "" {
+				t.Errorf("mismatch (-got +want):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestJobConfig_credsResolver_badConfig(t *testing.T) {
+	cfg := JobConfig{DockerAuthConfig: "not json"}
+	if _, err := cfg.credsResolver(); err == nil {
+		t.Error("credsResolver() succeeded with a malformed DOCKER_AUTH_CONFIG")
+	}
+}
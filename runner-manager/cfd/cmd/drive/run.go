@@ -1,9 +1,15 @@
 package drive
 
 import (
-	"log"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
 
 	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh"
 )
 
 var runCmd = &cobra.Command{
@@ -55,7 +61,108 @@ what the main goal of that script is.
 
 Read more in GitLab's documentation:
 https://docs.gitlab.com/runner/executors/custom.html#run`,
-	Run: func(cmd *cobra.Command, args []string) {
-		log.Println("running...")
-	},
+	Args: cobra.ExactArgs(2),
+	RunE: runScript,
+}
+
+type runStage commonStage
+
+func runScript(cmd *cobra.Command, args []string) error {
+	s, err := newStage(cmd.Context(), nil)
+	if err != nil {
+		return &SystemFailureError{fmt.Errorf("error initializing run stage: %w", err)}
+	}
+
+	ctx, cancel, err := stageContext(
+		cmd.Context(), "RUN_TIMEOUT", s.common.config.RunTimeout, 0,
+	)
+	if err != nil {
+		return &SystemFailureError{fmt.Errorf("error initializing run stage: %w", err)}
+	}
+	defer cancel()
+
+	err = s.run.exec(ctx, args[0], args[1])
+	if err != nil {
+		return fmt.Errorf("error executing run stage: %w", err)
+	}
+
+	return nil
+}
+
+func (s *runStage) exec(ctx context.Context, scriptPath string, stepName string) error {
+	script, err := os.ReadFile(scriptPath)
+	if err != nil {
+		return &SystemFailureError{
+			fmt.Errorf("error reading script for %v step: %w", stepName, err),
+		}
+	}
+
+	// DANGER: there may be sensitive information in traces, job logs
+	// made with RUNNER_DEBUG should be removed after use
+	if s.config.runnerDebug() {
+		// keep file variables around for a postmortem
+		if stepName == "cleanup_file_variables" {
+			fmt.Println("[cfd] RUNNER_DEBUG: skipping cleanup_file_variables")
+			return nil
+		}
+		script = withXtrace(script)
+	}
+
+	app, err := (*commonStage)(s).workerApp(ctx)
+	if err != nil {
+		return &SystemFailureError{err}
+	}
+
+	stop := (*commonStage)(s).streamServiceLogs(ctx, time.Now())
+	defer stop()
+
+	fmt.Printf(
+		"[cfd] Using SSH to connect to %v and run '%v' step\n",
+		s.config.ContainerID, stepName,
+	)
+
+	err = s.stage.RunSSH(ctx, app.GUID, "", bytes.NewReader(withProfile(script)))
+
+	var exitErr *ssh.ExitError
+	if errors.As(err, &exitErr) {
+		return &ScriptExitError{ExitCode: exitErr.ExitStatus(), Err: err}
+	}
+	if err != nil {
+		return &SystemFailureError{err}
+	}
+
+	fmt.Printf(
+		"[cfd] Completed SSH session with %v to run '%v' step\n",
+		s.config.ContainerID, stepName,
+	)
+
+	return nil
+}
+
+// withProfile sources the profile we send with the worker-setup bundle
+// right after the script's shebang, so each step gets the worker's env.
+func withProfile(script []byte) []byte {
+	source := []byte("\nsource \"$HOME/glrw-profile.sh\"\n")
+
+	if !bytes.HasPrefix(script, []byte("#!")) {
+		return append(source[1:], script...)
+	}
+
+	shebang, rest, _ := bytes.Cut(script, []byte("\n"))
+
+	out := make([]byte, 0, len(script)+len(source)+1)
+	out = append(out, shebang...)
+	out = append(out, '\n')
+	out = append(out, source...)
+	return append(out, rest...)
+}
+
+// withXtrace turns on xtrace inside the script's evals, so we don't get
+// double output, much like CI_DEBUG_TRACE though it may show more.
+func withXtrace(script []byte) []byte {
+	lines := bytes.SplitAfter(script, []byte("\n"))
+	for i, l := range lines {
+		lines[i] = bytes.Replace(l, []byte("eval $'"), []byte("eval $'set -o xtrace\n"), 1)
+	}
+	return bytes.Join(lines, nil)
 }
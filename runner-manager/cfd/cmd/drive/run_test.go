@@ -0,0 +1,85 @@
+package drive
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func Test_withProfile(t *testing.T) {
+	tests := map[string]struct {
+		script string
+		want   string
+	}{
+		"inserts after shebang": {
+			script: "#!/usr/bin/env bash\necho hi\n",
+			want:   "#!/usr/bin/env bash\n\nsource \"$HOME/glrw-profile.sh\"\necho hi\n",
+		},
+		"handles shebang-only script": {
+			script: "#!/bin/sh",
+			want:   "#!/bin/sh\n\nsource \"$HOME/glrw-profile.sh\"\n",
+		},
+		"prepends without shebang": {
+			script: "echo hi\n",
+			want:   "source \"$HOME/glrw-profile.sh\"\necho hi\n",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := string(withProfile([]byte(tt.script)))
+			if diff := cmp.Diff(got, tt.want); diff != "" {
+				t.Errorf("mismatch (-got +want):\n%s", diff)
+			}
+		})
+	}
+}
+
+func Test_withXtrace(t *testing.T) {
+	tests := map[string]struct {
+		script string
+		want   string
+	}{
+		"traces evals": {
+			script: "#!/usr/bin/env bash\neval $'echo hi\\n'\nexit 0\n",
+			want:   "#!/usr/bin/env bash\neval $'set -o xtrace\necho hi\\n'\nexit 0\n",
+		},
+		"traces the first eval on each line": {
+			script: "eval $'a' && eval $'b'\neval $'c'",
+			want:   "eval $'set -o xtrace\na' && eval $'b'\neval $'set -o xtrace\nc'",
+		},
+		"leaves scripts without evals alone": {
+			script: "echo hi\n",
+			want:   "echo hi\n",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := string(withXtrace([]byte(tt.script)))
+			if diff := cmp.Diff(got, tt.want); diff != "" {
+				t.Errorf("mismatch (-got +want):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestRunStage_exec_skipsFileVariableCleanup(t *testing.T) {
+	script := filepath.Join(t.TempDir(), "script")
+	if err := os.WriteFile(script, []byte("rm -f vars\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// no client or SSH, so this panics if it tries to run the step
+	s := &runStage{config: &JobConfig{
+		RunnerDebug:      "true",
+		RunnerDebugUsers: "dev@example.gov",
+		GitlabUserEmail:  "dev@example.gov",
+	}}
+	if err := s.exec(context.Background(), script, "cleanup_file_variables"); err != nil {
+		t.Errorf("exec() error = %v", err)
+	}
+}
@@ -0,0 +1,137 @@
+package drive
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// CopySSH recursively copies src on the manager into dst on the app's
+// first instance, speaking the SCP protocol over our own SSH connection.
+// CF's SSH daemon handles `scp -t` itself, so workers don't need scp.
+func (s *stage) CopySSH(ctx context.Context, guid string, src string, dst string) error {
+	client, err := s.sshConnect(ctx, guid)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	sess, err := client.NewSession()
+	if err != nil {
+		return fmt.Errorf("error opening ssh session: %w", err)
+	}
+	defer sess.Close()
+
+	w, err := sess.StdinPipe()
+	if err != nil {
+		return err
+	}
+	r, err := sess.StdoutPipe()
+	if err != nil {
+		return err
+	}
+
+	if dst == "" {
+		dst = "."
+	}
+	if err = sess.Start(fmt.Sprintf("scp -r -t %s", dst)); err != nil {
+		return fmt.Errorf("error starting scp: %w", err)
+	}
+
+	if err = scpSend(w, bufio.NewReader(r), src); err != nil {
+		return fmt.Errorf("error copying %v: %w", src, err)
+	}
+	w.Close()
+
+	return sess.Wait()
+}
+
+// scpSend writes src, a file or directory, to an SCP sink on w,
+// reading the sink's acknowledgements from r.
+func scpSend(w io.Writer, r *bufio.Reader, src string) error {
+	if err := scpAck(r); err != nil {
+		return err
+	}
+	return scpSendPath(w, r, src)
+}
+
+func scpSendPath(w io.Writer, r *bufio.Reader, path string) error {
+	// Stat rather than Lstat, dereferencing links like `scp -r` does
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	name := filepath.Base(path)
+	if strings.ContainsAny(name, "\n") {
+		return fmt.Errorf("can't send file with newline in name: %q", name)
+	}
+
+	if !info.IsDir() {
+		return scpSendFile(w, r, path, name, info)
+	}
+
+	if _, err = fmt.Fprintf(w, "D%04o 0 %s\n", info.Mode().Perm(), name); err != nil {
+		return err
+	}
+	if err = scpAck(r); err != nil {
+		return err
+	}
+
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if err = scpSendPath(w, r, filepath.Join(path, e.Name())); err != nil {
+			return err
+		}
+	}
+
+	if _, err = io.WriteString(w, "E\n"); err != nil {
+		return err
+	}
+	return scpAck(r)
+}
+
+func scpSendFile(w io.Writer, r *bufio.Reader, path string, name string, info os.FileInfo) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if _, err = fmt.Fprintf(w, "C%04o %d %s\n", info.Mode().Perm(), info.Size(), name); err != nil {
+		return err
+	}
+	if err = scpAck(r); err != nil {
+		return err
+	}
+
+	if _, err = io.CopyN(w, f, info.Size()); err != nil {
+		return err
+	}
+	if _, err = w.Write([]byte{0}); err != nil {
+		return err
+	}
+	return scpAck(r)
+}
+
+// scpAck reads a sink's reply: 0 is OK, 1 (warning) and 2 (fatal)
+// are followed by a message line.
+func scpAck(r *bufio.Reader) error {
+	b, err := r.ReadByte()
+	if err != nil {
+		return fmt.Errorf("error reading scp ack: %w", err)
+	}
+	if b == 0 {
+		return nil
+	}
+
+	msg, _ := r.ReadString('\n')
+	return fmt.Errorf("scp: %s", strings.TrimSpace(msg))
+}
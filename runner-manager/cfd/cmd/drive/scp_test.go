@@ -0,0 +1,61 @@
+package drive
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func Test_scpSend(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "bundle")
+	if err := os.MkdirAll(filepath.Join(src, "bin"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(src, "bin", "tool"), []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(src, "setup.sh"), []byte("hi"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(src, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	want := strings.Join([]string{
+		"D0755 0 bundle\n",
+		"D0755 0 bin\n",
+		"C0755 10 tool\n#!/bin/sh\n\x00",
+		"E\n",
+		"C0644 2 setup.sh\nhi\x00",
+		"E\n",
+	}, "")
+
+	var got bytes.Buffer
+	acks := bufio.NewReader(bytes.NewReader(make([]byte, 16)))
+
+	if err := scpSend(&got, acks, src); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(got.String(), want); diff != "" {
+		t.Errorf("mismatch (-got +want):\n%s", diff)
+	}
+}
+
+func Test_scpSend_sinkError(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(src, []byte("hi"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	acks := bufio.NewReader(strings.NewReader("\x00\x02No space left on device\n"))
+
+	err := scpSend(&bytes.Buffer{}, acks, src)
+	if err == nil || !strings.Contains(err.Error(), "No space left on device") {
+		t.Errorf("scpSend() error = %v, want sink's message", err)
+	}
+}
@@ -0,0 +1,185 @@
+package drive
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	sshHostDefault = "ssh.fr-stage.cloud.gov"
+	sshPortDefault = "2222"
+	sshDialTimeout = 30 * time.Second
+)
+
+// sshAddr returns host:port for CloudFoundry's SSH proxy.
+func (cfg *JobConfig) sshAddr() string {
+	host := cfg.SSHHost
+	if host == "" {
+		host = sshHostDefault
+	}
+	if _, _, err := net.SplitHostPort(host); err == nil {
+		return host
+	}
+	return net.JoinHostPort(host, sshPortDefault)
+}
+
+// sshConnect opens an SSH connection to the first instance of the app
+// with the given GUID, authenticating with a one-time code from cloud.gov.
+// The connection is closed if ctx is cancelled.
+func (s *stage) sshConnect(ctx context.Context, guid string) (client *ssh.Client, err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("error connecting via ssh to %v: %w", guid, err)
+		}
+	}()
+
+	pass, err := s.common.client.SSHCode(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	addr := s.common.config.sshAddr()
+	sshCfg := &ssh.ClientConfig{
+		User: fmt.Sprintf("cf:%s/0", guid),
+		Auth: []ssh.AuthMethod{ssh.Password(pass)},
+		// Parity with the shell driver's StrictHostKeyChecking=no
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		Timeout:         sshDialTimeout,
+	}
+
+	conn, err := s.common.config.EgressProxyConfig.dial(ctx, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	// Closing conn ends the handshake or any sessions on it. It's fine
+	// for this to run after we're done with conn, so we never stop it.
+	context.AfterFunc(ctx, func() { conn.Close() })
+
+	c, chans, reqs, err := ssh.NewClientConn(conn, addr, sshCfg)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return ssh.NewClient(c, chans, reqs), nil
+}
+
+// dial connects to addr, tunneling through the egress proxy with an
+// HTTP CONNECT request when one is configured (as corkscrew did for us).
+func (epCfg EgressProxyConfig) dial(ctx context.Context, addr string) (net.Conn, error) {
+	d := &net.Dialer{Timeout: sshDialTimeout}
+	if epCfg.ProxyHostSSH == "" {
+		return d.DialContext(ctx, "tcp", addr)
+	}
+
+	proxyAddr := net.JoinHostPort(epCfg.ProxyHostSSH, fmt.Sprint(epCfg.ProxyPortSSH))
+	conn, err := d.DialContext(ctx, "tcp", proxyAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	// unblock the CONNECT exchange below if we're cancelled
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: make(http.Header),
+	}
+
+	if epCfg.ProxyAuthFile != "" {
+		creds, err := os.ReadFile(epCfg.ProxyAuthFile)
+		if err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("error reading ProxyAuthFile: %w", err)
+		}
+		auth := base64.StdEncoding.EncodeToString(
+			[]byte(strings.TrimSpace(string(creds))),
+		)
+		req.Header.Set("Proxy-Authorization", "Basic "+auth)
+	}
+
+	if err = req.Write(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	br := bufio.NewReader(conn)
+	res, err := http.ReadResponse(br, req)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		conn.Close()
+		return nil, fmt.Errorf("egress proxy refused CONNECT to %v: %v", addr, res.Status)
+	}
+
+	return &bufferedConn{Conn: conn, r: br}, nil
+}
+
+// bufferedConn keeps anything the proxy's response reader buffered past
+// the CONNECT response, e.g., the start of the SSH server's banner.
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
+
+// RunSSH runs cmd on the app's first instance, streaming its output to
+// ours. If cmd is empty a shell is started and fed stdin instead.
+//
+// A non-zero exit from the remote command is returned as *ssh.ExitError.
+// Cancelling ctx closes the connection, ending the remote command.
+func (s *stage) RunSSH(ctx context.Context, guid string, cmd string, stdin io.Reader) (err error) {
+	defer func() {
+		if err != nil && ctx.Err() != nil {
+			err = fmt.Errorf("ssh session interrupted: %w", errors.Join(ctx.Err(), err))
+		}
+	}()
+
+	client, err := s.sshConnect(ctx, guid)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	sess, err := client.NewSession()
+	if err != nil {
+		return fmt.Errorf("error opening ssh session: %w", err)
+	}
+	defer sess.Close()
+
+	sess.Stdin = stdin
+	sess.Stdout = os.Stdout
+	sess.Stderr = os.Stderr
+
+	if cmd != "" {
+		return sess.Run(cmd)
+	}
+
+	if err = sess.Shell(); err != nil {
+		return fmt.Errorf("error starting remote shell: %w", err)
+	}
+	return sess.Wait()
+}
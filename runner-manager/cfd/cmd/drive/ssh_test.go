@@ -0,0 +1,91 @@
+package drive
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestJobConfig_sshAddr(t *testing.T) {
+	tests := map[string]struct {
+		host string
+		want string
+	}{
+		"uses default host":         {want: "ssh.fr-stage.cloud.gov:2222"},
+		"adds default port to host": {host: "ssh.fr.cloud.gov", want: "ssh.fr.cloud.gov:2222"},
+		"keeps port from host":      {host: "ssh.fr.cloud.gov:22", want: "ssh.fr.cloud.gov:22"},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := (&JobConfig{SSHHost: tt.host}).sshAddr()
+			if diff := cmp.Diff(got, tt.want); diff != "" {
+				t.Errorf("mismatch (-got +want):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestEgressProxyConfig_dial(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	gotReq := make(chan *http.Request, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		req, err := http.ReadRequest(bufio.NewReader(conn))
+		if err != nil {
+			return
+		}
+		gotReq <- req
+
+		// send the banner along with the response to check it isn't lost
+		io.WriteString(conn, "HTTP/1.1 200 Connection established\r\n\r\nSSH-2.0-test\r\n")
+	}()
+
+	authFile := filepath.Join(t.TempDir(), "ssh_proxy.auth")
+	if err := os.WriteFile(authFile, []byte("bingo:dingo\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	host, port, _ := net.SplitHostPort(l.Addr().String())
+	epCfg := EgressProxyConfig{ProxyHostSSH: host, ProxyAuthFile: authFile}
+	epCfg.ProxyPortSSH, _ = net.LookupPort("tcp", port)
+
+	conn, err := epCfg.dial(context.Background(), "ssh.example.gov:2222")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	req := <-gotReq
+	if req.Method != http.MethodConnect || req.Host != "ssh.example.gov:2222" {
+		t.Errorf("unexpected request: %v %v", req.Method, req.Host)
+	}
+	if diff := cmp.Diff(req.Header.Get("Proxy-Authorization"), "Basic YmluZ286ZGluZ28="); diff != "" {
+		t.Errorf("mismatch (-got +want):\n%s", diff)
+	}
+
+	banner, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(banner, "SSH-2.0-test\r\n"); diff != "" {
+		t.Errorf("mismatch (-got +want):\n%s", diff)
+	}
+}
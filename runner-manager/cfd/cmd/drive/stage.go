@@ -1,18 +1,25 @@
 package drive
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"os/exec"
-	"strings"
+	"strconv"
+	"time"
 
 	"github.com/GSA-TTS/gitlab-runner-cloudgov/runner-manager/cfd/cloudgov"
 )
 
+const (
+	prepareTimeoutDefault = time.Hour
+	cleanupTimeoutDefault = 10 * time.Minute
+)
+
 type stage struct {
 	// conf
-	prep *prepStage
-	// run
-	// clean
+	prep  *prepStage
+	run   *runStage
+	clean *cleanupStage
 
 	common commonStage
 }
@@ -23,7 +30,15 @@ type commonStage struct {
 	config *JobConfig
 }
 
-func newStage(client *cloudgov.Client) (s *stage, err error) {
+func newStage(ctx context.Context, client *cloudgov.Client) (*stage, error) {
+	return newStageWith(ctx, client, getJobConfig)
+}
+
+// newStageWith is newStage with the job config from getConfig, e.g.,
+// cleanup's, which needs much less of it.
+func newStageWith(
+	ctx context.Context, client *cloudgov.Client, getConfig func() (*JobConfig, error),
+) (s *stage, err error) {
 	defer func() {
 		if err != nil {
 			err = fmt.Errorf("error creating stage: %w", err)
@@ -33,7 +48,7 @@ func newStage(client *cloudgov.Client) (s *stage, err error) {
 	s = &stage{}
 	s.common.stage = s
 
-	s.common.config, err = getJobConfig()
+	s.common.config, err = getConfig()
 	if err != nil {
 		return
 	}
@@ -41,9 +56,15 @@ func newStage(client *cloudgov.Client) (s *stage, err error) {
 	if client != nil {
 		s.common.client = client
 	} else {
+		var retry *cloudgov.RetryOpts
+		if retry, err = s.common.config.retryOpts(); err != nil {
+			return
+		}
+
 		s.common.client, err = cloudgov.New(
+			ctx,
 			&cloudgov.CFClientAPI{},
-			&cloudgov.Opts{APIRootURL: s.common.config.CFApi},
+			&cloudgov.Opts{APIRootURL: s.common.config.CFApi, Retry: retry},
 		)
 		if err != nil {
 			return
@@ -52,40 +73,147 @@ func newStage(client *cloudgov.Client) (s *stage, err error) {
 
 	// conf
 	s.prep = (*prepStage)(&s.common)
-	// run
-	// clean
+	s.run = (*runStage)(&s.common)
+	s.clean = (*cleanupStage)(&s.common)
 
 	return
 }
 
-func (s *stage) RunSSH(guid string, cmd string) error {
-	pass, err := s.common.client.SSHCode()
+// retryOpts sets how hard the CF client retries transient failures,
+// leaving anything unset to the client's defaults.
+func (cfg *JobConfig) retryOpts() (*cloudgov.RetryOpts, error) {
+	opts := &cloudgov.RetryOpts{}
+
+	if cfg.CFRetryAttempts != "" {
+		n, err := strconv.Atoi(cfg.CFRetryAttempts)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid CF_RETRY_ATTEMPTS %q, want a positive number", cfg.CFRetryAttempts)
+		}
+		opts.MaxAttempts = n
+	}
+
+	d, err := parseTimeout("CF_RETRY_MAX_DELAY", cfg.CFRetryMaxDelay, 0)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	opts.MaxDelay = d
 
-	args := []string{"ssh", "-p 2222", "-T", "-o StrictHostKeyChecking=no"}
-	host := fmt.Sprintf("cf:%s/0@ssh.fr-stage.cloud.gov", guid)
+	return opts, nil
+}
 
-	// TODO: can we rely on the Bash runner's .profile's edits to SSH Config?
-	// See: https://github.com/GSA-TTS/gitlab-runner-cloudgov/issues/136
-	epCfg := s.common.config.EgressProxyConfig
-	if epCfg != (EgressProxyConfig{}) {
-		proxy := fmt.Sprintf("-o ProxyCommand corkscrew %v %v %%h %%p %v",
-			epCfg.ProxyHostSSH, epCfg.ProxyPortSSH, epCfg.ProxyAuthFile,
-		)
-		args = append(args, proxy)
+// stageContext bounds a stage's CF calls and SSH sessions by the timeout
+// in val, or def if it's unset. A zero timeout means no deadline.
+// The root context is already cancelled on SIGTERM/SIGINT.
+func stageContext(
+	parent context.Context, key string, val string, def time.Duration,
+) (context.Context, context.CancelFunc, error) {
+	timeout, err := parseTimeout(key, val, def)
+	if err != nil {
+		return nil, nil, err
+	}
+	if timeout == 0 {
+		ctx, cancel := context.WithCancel(parent)
+		return ctx, cancel, nil
+	}
+	ctx, cancel := context.WithTimeout(parent, timeout)
+	return ctx, cancel, nil
+}
+
+// parseTimeout parses val, set in env var key, as a duration ("90s",
+// "5m") or a number of seconds, or returns def if val is unset.
+func parseTimeout(key string, val string, def time.Duration) (time.Duration, error) {
+	if val == "" {
+		return def, nil
+	}
+
+	v := val
+	if secs, err := strconv.Atoi(v); err == nil {
+		v = fmt.Sprintf("%ds", secs)
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid %v %q, want e.g. \"300\" or \"5m\"", key, val)
 	}
+	return d, nil
+}
 
-	sshCmd := exec.Command("sshpass", append(args, host)...)
-	sshCmd.Stdin = strings.NewReader(pass) // give pass to sshpass through stdin
+// workerSpaceGUID resolves WORKER_ORG and WORKER_SPACE, which we know
+// already if they're the manager's own.
+func (s *commonStage) workerSpaceGUID(ctx context.Context) (string, error) {
+	cfg := s.config
+	if cfg.SpaceID != "" && cfg.WorkerOrg == cfg.OrgName && cfg.WorkerSpace == cfg.SpaceName {
+		return cfg.SpaceID, nil
+	}
 
-	out, err := sshCmd.Output()
+	space, err := s.client.SpaceFind(ctx, cfg.WorkerOrg, cfg.WorkerSpace)
 	if err != nil {
-		return err
+		return "", fmt.Errorf("error finding worker space: %w", err)
 	}
+	return space.GUID, nil
+}
 
-	fmt.Print(string(out))
+// workerApp finds the job's worker app by its container ID.
+func (s *commonStage) workerApp(ctx context.Context) (*cloudgov.App, error) {
+	spaceGUID, err := s.workerSpaceGUID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	app, err := s.client.AppFindInSpace(ctx, spaceGUID, s.config.ContainerID)
+	if err != nil {
+		return nil, fmt.Errorf("could not find worker app %v: %w", s.config.ContainerID, err)
+	}
+	return app, nil
+}
+
+// jobApps finds whichever of the job's worker and service apps exist,
+// by name.
+func (s *commonStage) jobApps(ctx context.Context) (map[string]*cloudgov.App, error) {
+	spaceGUID, err := s.workerSpaceGUID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{s.config.ContainerID}
+	for _, serv := range s.config.Services {
+		names = append(names, serv.Manifest.Name)
+	}
+
+	apps, err := s.client.AppsListFiltered(ctx, &cloudgov.AppsFilter{
+		SpaceGUIDs: []string{spaceGUID},
+		Names:      names,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	byName := make(map[string]*cloudgov.App, len(apps))
+	for _, app := range apps {
+		if app != nil {
+			byName[app.Name] = app
+		}
+	}
+	return byName, nil
+}
+
+// deleteApp deletes app along with its routes and network policies.
+func (s *commonStage) deleteApp(ctx context.Context, name string, app *cloudgov.App) error {
+	if app == nil {
+		fmt.Printf("[cfd] Could not find %v, skipping\n", name)
+		return nil
+	}
+
+	var errs []error
+
+	if err := s.client.RemoveNetworkPolicies(ctx, app); err != nil {
+		errs = append(errs, fmt.Errorf("error removing network policies for %v: %w", name, err))
+	}
+	if err := s.client.DeleteAppRoutes(ctx, app); err != nil {
+		errs = append(errs, fmt.Errorf("error deleting routes for %v: %w", name, err))
+	}
+	if err := s.client.AppDelete(ctx, app.GUID); err != nil && !errors.Is(err, cloudgov.ErrNotFound) {
+		errs = append(errs, fmt.Errorf("error deleting %v: %w", name, err))
+	}
 
-	return nil
+	return errors.Join(errs...)
 }
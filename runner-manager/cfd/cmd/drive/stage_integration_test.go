@@ -3,7 +3,7 @@
 package drive
 
 import (
-	"os/exec"
+	"context"
 	"testing"
 
 	"github.com/GSA-TTS/gitlab-runner-cloudgov/runner-manager/cfd/cloudgov"
@@ -28,22 +28,18 @@ func setup(t testing.TB) {
 func Test_RunSSH(t *testing.T) {
 	setup(t)
 
-	stage, err := newStage(cgClient)
+	stage, err := newStage(context.Background(), cgClient)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	apps, err := cgClient.AppsList()
+	apps, err := cgClient.AppsList(context.Background())
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	err = stage.RunSSH(apps[0].GUID, "echo $VCAP_APPLICATION")
+	err = stage.RunSSH(context.Background(), apps[0].GUID, "echo $VCAP_APPLICATION", nil)
 	if err != nil {
-		if exitErr, ok := err.(*exec.ExitError); ok {
-			t.Fatal(string(exitErr.Stderr))
-		} else {
-			t.Fatal(err)
-		}
+		t.Fatal(err)
 	}
 }
@@ -0,0 +1,82 @@
+package drive
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func Test_parseTimeout(t *testing.T) {
+	tests := map[string]struct {
+		val     string
+		def     time.Duration
+		want    time.Duration
+		wantErr bool
+	}{
+		"uses the default when unset": {def: time.Hour, want: time.Hour},
+		"parses seconds":              {val: "90", want: 90 * time.Second},
+		"parses a duration":           {val: "2m30s", want: 150 * time.Second},
+		"fails with garbage":          {val: "soon", wantErr: true},
+		"fails with a zero timeout":   {val: "0", wantErr: true},
+		"fails with a negative one":   {val: "-1m", wantErr: true},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := parseTimeout("TEST_TIMEOUT", tt.val, tt.def)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseTimeout() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("parseTimeout() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_stageContext(t *testing.T) {
+	t.Run("has no deadline without a timeout", func(t *testing.T) {
+		ctx, cancel, err := stageContext(context.Background(), "TEST_TIMEOUT", "", 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer cancel()
+
+		if _, ok := ctx.Deadline(); ok {
+			t.Error("got a deadline, want none")
+		}
+	})
+
+	t.Run("sets a deadline from the timeout", func(t *testing.T) {
+		ctx, cancel, err := stageContext(context.Background(), "TEST_TIMEOUT", "60", time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer cancel()
+
+		deadline, ok := ctx.Deadline()
+		if !ok || time.Until(deadline) > time.Minute {
+			t.Errorf("got deadline %v, want one within a minute", deadline)
+		}
+	})
+
+	t.Run("is cancelled with its parent", func(t *testing.T) {
+		parent, cancelParent := context.WithCancel(context.Background())
+		ctx, cancel, err := stageContext(parent, "TEST_TIMEOUT", "", time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer cancel()
+
+		cancelParent()
+		if ctx.Err() == nil {
+			t.Error("stage context wasn't cancelled with its parent")
+		}
+	})
+
+	t.Run("fails with a bad timeout", func(t *testing.T) {
+		if _, _, err := stageContext(context.Background(), "TEST_TIMEOUT", "soon", 0); err == nil {
+			t.Error("got no error, want one")
+		}
+	})
+}
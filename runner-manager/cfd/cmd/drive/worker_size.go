@@ -0,0 +1,129 @@
+package drive
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	// Job and service variables overriding the runner's WORKER_MEMORY and
+	// WORKER_DISK_SIZE
+	workerMemoryVar = "WORKER_MEMORY"
+	workerDiskVar   = "WORKER_DISK"
+)
+
+var cfSizeRegex = regexp.MustCompile(`^(\d+)\s*([MmGgTt])[Bb]?$`)
+
+// cfSize is a memory or disk size in megabytes, as CF counts them.
+type cfSize int
+
+// parseCFSize reads sizes like CF manifests take them, e.g., "512M",
+// "2G", or "1gb".
+func parseCFSize(s string) (cfSize, error) {
+	m := cfSizeRegex.FindStringSubmatch(strings.TrimSpace(s))
+	if m == nil {
+		return 0, fmt.Errorf(`%q isn't a size, e.g., "512M" or "2G"`, s)
+	}
+
+	n, err := strconv.Atoi(m[1])
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf(`%q isn't a size, e.g., "512M" or "2G"`, s)
+	}
+
+	unit := 1
+	switch strings.ToUpper(m[2]) {
+	case "G":
+		unit = 1024
+	case "T":
+		unit = 1024 * 1024
+	}
+	if n > math.MaxInt/unit {
+		return 0, fmt.Errorf("%q is too big a size", s)
+	}
+	return cfSize(n * unit), nil
+}
+
+// String is the size in megabytes, e.g., "2G" is "2048M".
+func (s cfSize) String() string {
+	return fmt.Sprintf("%dM", s)
+}
+
+// sizeLimits are the runner's bounds on what jobs can ask for, 0 is
+// unbounded.
+type sizeLimits struct {
+	min cfSize
+	max cfSize
+}
+
+func parseSizeLimits(minKey string, minVal string, maxKey string, maxVal string) (l sizeLimits, err error) {
+	if minVal != "" {
+		if l.min, err = parseCFSize(minVal); err != nil {
+			return l, fmt.Errorf("error parsing %v: %w", minKey, err)
+		}
+	}
+	if maxVal != "" {
+		if l.max, err = parseCFSize(maxVal); err != nil {
+			return l, fmt.Errorf("error parsing %v: %w", maxKey, err)
+		}
+	}
+	if l.max > 0 && l.min > l.max {
+		return l, fmt.Errorf("%v %v is more than %v %v", minKey, l.min, maxKey, l.max)
+	}
+	return l, nil
+}
+
+// workerSize picks the size to give an app, normalized for CF: the
+// override from vars if any, within limits, else the runner's default.
+func workerSize(vars []CIVar, key string, def string, limits sizeLimits) (string, error) {
+	val, ok := ciVar(vars, key)
+	if !ok || val == "" {
+		if def == "" {
+			return "", nil
+		}
+		size, err := parseCFSize(def)
+		if err != nil {
+			return "", fmt.Errorf("error parsing runner's default %v: %w", key, err)
+		}
+		return size.String(), nil
+	}
+
+	size, err := parseCFSize(val)
+	if err != nil {
+		return "", fmt.Errorf("error parsing %v: %w", key, err)
+	}
+	if limits.min > 0 && size < limits.min {
+		return "", fmt.Errorf("%v %v is under the runner's minimum of %v", key, val, limits.min)
+	}
+	if limits.max > 0 && size > limits.max {
+		return "", fmt.Errorf("%v %v is over the runner's maximum of %v", key, val, limits.max)
+	}
+	return size.String(), nil
+}
+
+// workerSizes works out memory and disk for an app whose job or service
+// variables are vars.
+func (cfg *JobConfig) workerSizes(vars []CIVar) (memory string, disk string, err error) {
+	memLimits, err := parseSizeLimits(
+		"WORKER_MEMORY_MIN", cfg.WorkerMemoryMin, "WORKER_MEMORY_MAX", cfg.WorkerMemoryMax,
+	)
+	if err != nil {
+		return "", "", err
+	}
+	diskLimits, err := parseSizeLimits(
+		"WORKER_DISK_SIZE_MIN", cfg.WorkerDiskSizeMin, "WORKER_DISK_SIZE_MAX", cfg.WorkerDiskSizeMax,
+	)
+	if err != nil {
+		return "", "", err
+	}
+
+	if memory, err = workerSize(vars, workerMemoryVar, cfg.WorkerMemory, memLimits); err != nil {
+		return "", "", err
+	}
+	if disk, err = workerSize(vars, workerDiskVar, cfg.WorkerDiskSize, diskLimits); err != nil {
+		return "", "", err
+	}
+	return memory, disk, nil
+}
@@ -0,0 +1,130 @@
+package drive
+
+import (
+	"strings"
+	"testing"
+)
+
+func Test_parseCFSize(t *testing.T) {
+	tests := map[string]struct {
+		want    cfSize
+		wantErr bool
+	}{
+		"512M":  {want: 512},
+		"512MB": {want: 512},
+		"2G":    {want: 2048},
+		"2gb":   {want: 2048},
+		"1 G":   {want: 1024},
+		"1T":    {want: 1024 * 1024},
+		"":      {wantErr: true},
+		"512":   {wantErr: true},
+		"0M":    {wantErr: true},
+		"1.5G":  {wantErr: true},
+		"-1G":   {wantErr: true},
+		"lots":  {wantErr: true},
+
+		// 2^43 and 2^53, which overflow once in megabytes
+		"8796093022208T":    {wantErr: true},
+		"9007199254740992G": {wantErr: true},
+	}
+
+	for s, tt := range tests {
+		t.Run(s, func(t *testing.T) {
+			got, err := parseCFSize(s)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseCFSize() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("parseCFSize() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestJobConfig_workerSizes(t *testing.T) {
+	runner := JobConfig{
+		WorkerMemory:      "768M",
+		WorkerDiskSize:    "1G",
+		WorkerMemoryMin:   "256M",
+		WorkerMemoryMax:   "4G",
+		WorkerDiskSizeMax: "8G",
+	}
+
+	tests := map[string]struct {
+		cfg        JobConfig
+		vars       []CIVar
+		wantMemory string
+		wantDisk   string
+		wantErr    string
+	}{
+		"uses the runner's defaults": {
+			cfg:        runner,
+			wantMemory: "768M",
+			wantDisk:   "1024M",
+		},
+		"leaves sizes to CF without defaults": {},
+		"takes overrides": {
+			cfg:        runner,
+			vars:       []CIVar{{Key: "WORKER_MEMORY", Value: "2gb"}, {Key: "WORKER_DISK", Value: "4G"}},
+			wantMemory: "2048M",
+			wantDisk:   "4096M",
+		},
+		"takes the last override": {
+			cfg:        runner,
+			vars:       []CIVar{{Key: "WORKER_MEMORY", Value: "2G"}, {Key: "WORKER_MEMORY", Value: "1G"}},
+			wantMemory: "1024M",
+			wantDisk:   "1024M",
+		},
+		"allows overrides at the limits": {
+			cfg:        runner,
+			vars:       []CIVar{{Key: "WORKER_MEMORY", Value: "256M"}, {Key: "WORKER_DISK", Value: "8G"}},
+			wantMemory: "256M",
+			wantDisk:   "8192M",
+		},
+		"fails over the max": {
+			cfg:     runner,
+			vars:    []CIVar{{Key: "WORKER_MEMORY", Value: "16G"}},
+			wantErr: "WORKER_MEMORY 16G is over the runner's maximum of 4096M",
+		},
+		"fails under the min": {
+			cfg:     runner,
+			vars:    []CIVar{{Key: "WORKER_MEMORY", Value: "128M"}},
+			wantErr: "WORKER_MEMORY 128M is under the runner's minimum of 256M",
+		},
+		"fails with malformed overrides": {
+			cfg:     runner,
+			vars:    []CIVar{{Key: "WORKER_DISK", Value: "lots"}},
+			wantErr: `error parsing WORKER_DISK: "lots" isn't a size`,
+		},
+		"fails with malformed defaults": {
+			cfg:     JobConfig{WorkerMemory: "768"},
+			wantErr: "error parsing runner's default WORKER_MEMORY",
+		},
+		"fails with malformed limits": {
+			cfg:     JobConfig{WorkerDiskSizeMax: "big"},
+			wantErr: "error parsing WORKER_DISK_SIZE_MAX",
+		},
+		"fails with crossed limits": {
+			cfg:     JobConfig{WorkerMemoryMin: "2G", WorkerMemoryMax: "1G"},
+			wantErr: "WORKER_MEMORY_MIN 2048M is more than WORKER_MEMORY_MAX 1024M",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			memory, disk, err := tt.cfg.workerSizes(tt.vars)
+			if (err != nil) != (tt.wantErr != "") {
+				t.Fatalf("workerSizes() error = %v, wantErr %q", err, tt.wantErr)
+			}
+			if err != nil {
+				if !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("workerSizes() error = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if memory != tt.wantMemory || disk != tt.wantDisk {
+				t.Errorf("workerSizes() = %v, %v, want %v, %v", memory, disk, tt.wantMemory, tt.wantDisk)
+			}
+		})
+	}
+}
@@ -1,8 +1,11 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/GSA-TTS/gitlab-runner-cloudgov/runner-manager/cfd/cmd/drive"
 
@@ -22,9 +25,25 @@ The gitlab-runner service should run cfd with it's "drive" subcommands,
 e.g., "cfd drive prepare".`,
 }
 
+// Execute runs cfd with a context that's cancelled when gitlab-runner
+// stops us, e.g., when a job is cancelled or a stage times out, so CF
+// calls in flight stop with us.
 func Execute() {
-	if err := rootCmd.Execute(); err != nil {
+	ctx, stop := signal.NotifyContext(
+		context.Background(), syscall.SIGTERM, syscall.SIGINT,
+	)
+
+	err := rootCmd.ExecuteContext(ctx)
+	stop()
+
+	if err != nil {
 		fmt.Println(err)
-		os.Exit(1)
+		if hint := drive.FailureHint(err); hint != "" {
+			fmt.Printf("[cfd] Hint: %v\n", hint)
+		}
+		if wErr := drive.WriteBuildExitCode(err); wErr != nil {
+			fmt.Fprintln(os.Stderr, wErr)
+		}
+		os.Exit(drive.FailureExitCode(err))
 	}
 }
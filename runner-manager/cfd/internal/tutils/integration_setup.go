@@ -2,6 +2,7 @@ package tutils
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"os"
 	"path"
@@ -67,7 +68,7 @@ func IntegrationSetup(t testing.TB) (client *cg.Client, org string, space string
 		return
 	}
 
-	client, err = cg.New(&cg.CFClientAPI{}, &cg.Opts{
+	client, err = cg.New(context.Background(), &cg.CFClientAPI{}, &cg.Opts{
 		Creds: &cg.Creds{Username: user, Password: pass},
 	})
 	if err != nil {
@@ -80,7 +81,7 @@ func IntegrationSetup(t testing.TB) (client *cg.Client, org string, space string
 
 func CleanupApp(t testing.TB, c *cg.Client, guid string) {
 	t.Helper()
-	if err := c.AppDelete(guid); err != nil {
+	if err := c.AppDelete(context.Background(), guid); err != nil {
 		t.Errorf("failed to delete app: %s", guid)
 	}
 }